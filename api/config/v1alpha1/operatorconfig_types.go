@@ -0,0 +1,66 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisDefaults are fleet wide defaults applied to every redis instance,
+// values set on the redis resource take precedence
+type RedisDefaults struct {
+	// Version of redis used when spec.version is not set
+	Version string `json:"version,omitempty"`
+
+	// LogLevel used when spec.logLevel is not set
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// Image repository redis is pulled from, for example a registry mirror.
+	// The tag is derived from the version. Defaults to redis, instances
+	// running another engine use the images of that engine
+	Image string `json:"image,omitempty"`
+
+	// ExporterImage used for the metrics sidecar when spec.metrics.image is
+	// not set
+	ExporterImage string `json:"exporterImage,omitempty"`
+
+	// RestoreImage downloads the dump of spec.restoreFrom, it needs curl and
+	// sha256sum. Defaults to a pinned curl image
+	RestoreImage string `json:"restoreImage,omitempty"`
+
+	// Resources of the redis containers
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Affinity of the redis pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// OperatorConfig is the configuration file of the operator, it is reloaded
+// while the operator runs
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Defaults applied to every redis instance
+	Defaults RedisDefaults `json:"defaults,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{})
+}
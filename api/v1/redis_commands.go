@@ -0,0 +1,121 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// commandPolicySince is the first release line with ACLs, the command policy
+// relies on them to keep an admin user for the operator
+const commandPolicySince = "6.0"
+
+// undisableableCommands are needed by the probes and by clients to
+// authenticate, disabling them would leave the instance unusable
+var undisableableCommands = map[string]bool{
+	"auth":  true,
+	"hello": true,
+	"ping":  true,
+}
+
+// operatorCommands are run by the operator or between master and replicas,
+// renaming them would break the management of the instance
+var operatorCommands = map[string]bool{
+	"auth":      true,
+	"failover":  true,
+	"hello":     true,
+	"info":      true,
+	"module":    true,
+	"ping":      true,
+	"psync":     true,
+	"replconf":  true,
+	"replicaof": true,
+	"slaveof":   true,
+	"sync":      true,
+}
+
+// commandName matches a redis command name
+var commandName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// validateCommandPolicy used to validate the disabled and renamed commands do
+// not conflict with each other or with the commands the operator relies on
+func (r *Redis) validateCommandPolicy() field.ErrorList {
+	policy := r.Spec.CommandPolicy
+	if policy == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("commandPolicy")
+	if !AtLeast(r.compatibleVersion(), commandPolicySince) {
+		errs = append(errs, field.Forbidden(path, "commandPolicy requires redis "+commandPolicySince+" or later"))
+	}
+
+	disabled := map[string]bool{}
+	for i, command := range policy.Disabled {
+		p := path.Child("disabled").Index(i)
+		name := strings.ToLower(command)
+		switch {
+		case !commandName.MatchString(command):
+			errs = append(errs, field.Invalid(p, command, "invalid command name"))
+		case undisableableCommands[name]:
+			errs = append(errs, field.Forbidden(p, command+" is required by the probes and clients and cannot be disabled"))
+		case disabled[name]:
+			errs = append(errs, field.Duplicate(p, command))
+		}
+		disabled[name] = true
+	}
+
+	commands := make([]string, 0, len(policy.Renamed))
+	for command := range policy.Renamed {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	renamed := map[string]int{}
+	for _, command := range commands {
+		renamed[strings.ToLower(command)]++
+	}
+	targets := map[string]bool{}
+	for _, command := range commands {
+		p := path.Child("renamed").Key(command)
+		name := strings.ToLower(command)
+		target := policy.Renamed[command]
+		switch {
+		case !commandName.MatchString(command):
+			errs = append(errs, field.Invalid(p, command, "invalid command name"))
+		case renamed[name] > 1:
+			errs = append(errs, field.Duplicate(p, command))
+		case operatorCommands[name]:
+			errs = append(errs, field.Forbidden(p, command+" is required by the operator and cannot be renamed"))
+		case disabled[name]:
+			errs = append(errs, field.Invalid(p, target, command+" cannot be both disabled and renamed"))
+		case target == "":
+			errs = append(errs, field.Invalid(p, target, "renaming to an empty name disables the command, use disabled instead"))
+		case !commandName.MatchString(target):
+			errs = append(errs, field.Invalid(p, target, "invalid command name"))
+		case operatorCommands[strings.ToLower(target)] || renamed[strings.ToLower(target)] > 0 || disabled[strings.ToLower(target)]:
+			errs = append(errs, field.Invalid(p, target, "renaming to an existing command is not allowed"))
+		case targets[strings.ToLower(target)]:
+			errs = append(errs, field.Duplicate(p, target))
+		}
+		targets[strings.ToLower(target)] = true
+	}
+	return errs
+}
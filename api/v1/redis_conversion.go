@@ -0,0 +1,448 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v2 "github.com/spazzy757/simple-redis/api/v2"
+)
+
+// ConversionDataAnnotation keeps the v2 fields v1 can not represent, so a
+// v2 object read and written back as v1 does not lose them
+const ConversionDataAnnotation = "simple.simple.redis/conversion-data"
+
+// conversionData holds the fields one version can not represent exactly
+type conversionData struct {
+	// ReplicasService is set when the replica service is exposed differently
+	// than the master service. It was written on v1 objects before v1 had
+	// per role services and is only read
+	ReplicasService *v2.ServiceSpec `json:"replicasService,omitempty"`
+
+	// Services keeps how a v1 object spelled the service exposure when v2
+	// would read back a different but equivalent spelling
+	Services *serviceSpelling `json:"services,omitempty"`
+}
+
+// serviceSpelling is the service exposure of v1, spec.service applies to the
+// roles that do not set their own
+type serviceSpelling struct {
+	Service  *ServiceSpec `json:"service,omitempty"`
+	Master   *ServiceSpec `json:"master,omitempty"`
+	Replicas *ServiceSpec `json:"replicas,omitempty"`
+}
+
+// spellServices used to get the v1 spelling of the per role services of the
+// hub, spec.service is used when both roles are exposed the same way
+func spellServices(master, replicas *v2.ServiceSpec) serviceSpelling {
+	if apiequality.Semantic.DeepEqual(master, replicas) {
+		return serviceSpelling{Service: convertServiceFrom(master)}
+	}
+	return serviceSpelling{
+		Master:   convertServiceFrom(master),
+		Replicas: convertServiceFrom(replicas),
+	}
+}
+
+// resolve used to get the services the master and the replicas are exposed
+// with
+func (s serviceSpelling) resolve() (master, replicas *v2.ServiceSpec) {
+	master, replicas = convertServiceTo(s.Service), convertServiceTo(s.Service)
+	if s.Master != nil {
+		master = convertServiceTo(s.Master)
+	}
+	if s.Replicas != nil {
+		replicas = convertServiceTo(s.Replicas)
+	}
+	return master, replicas
+}
+
+var _ conversion.Convertible = &Redis{}
+
+// ConvertTo converts this Redis to the hub version
+func (r *Redis) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v2.Redis)
+	dst.ObjectMeta = *r.ObjectMeta.DeepCopy()
+
+	spec := r.Spec.DeepCopy()
+	dst.Spec = v2.RedisSpec{
+		Mode:        v2.RedisMode(spec.Mode),
+		ClusterSize: spec.ClusterSize,
+		LogLevel:    v2.RedisLogLevel(spec.LogLevel),
+		Databases:   spec.Databases,
+		Config:      spec.Config,
+		Engine:      v2.RedisEngine(spec.Engine),
+		Version:     spec.Version,
+		Port:        spec.Port,
+		Paused:      spec.Paused,
+
+		PodSecurityContext:       spec.PodSecurityContext,
+		ContainerSecurityContext: spec.ContainerSecurityContext,
+		PodTemplate:              spec.PodTemplate,
+		Master: v2.MasterSpec{
+			Resources:    spec.Master.Resources,
+			Persistence:  convertPersistenceTo(spec.Master.Persistence),
+			Config:       spec.Master.Config,
+			NodeSelector: spec.Master.NodeSelector,
+			Tolerations:  spec.Master.Tolerations,
+			Affinity:     spec.Master.Affinity,
+		},
+		Replicas: v2.ReplicasSpec{
+			Resources:    spec.Replicas.Resources,
+			Persistence:  convertPersistenceTo(spec.Replicas.Persistence),
+			Config:       spec.Replicas.Config,
+			NodeSelector: spec.Replicas.NodeSelector,
+			Tolerations:  spec.Replicas.Tolerations,
+			Affinity:     spec.Replicas.Affinity,
+		},
+		Binding: v2.BindingSpec{
+			ConfigMap: spec.Binding.ConfigMap,
+		},
+	}
+	if probes := spec.Probes; probes != nil {
+		dst.Spec.Probes = &v2.ProbesSpec{
+			Startup:   convertProbeTo(probes.Startup),
+			Liveness:  convertProbeTo(probes.Liveness),
+			Readiness: convertProbeTo(probes.Readiness),
+		}
+	}
+	for _, module := range spec.Modules {
+		dst.Spec.Modules = append(dst.Spec.Modules, v2.ModuleSpec{
+			Name:  v2.ModuleName(module.Name),
+			Path:  module.Path,
+			Image: module.Image,
+			Args:  module.Args,
+		})
+	}
+	if src := spec.RestoreFrom; src != nil {
+		dst.Spec.Persistence.RestoreFrom = &v2.RestoreSource{
+			URL:        src.URL,
+			SHA256:     src.SHA256,
+			SecretName: src.SecretName,
+		}
+	}
+	if auth := spec.Auth; auth != nil {
+		dst.Spec.Auth = &v2.AuthSpec{
+			SecretName: auth.SecretName,
+			SecretKey:  auth.SecretKey,
+		}
+	}
+	if metrics := spec.Metrics; metrics != nil {
+		dst.Spec.Metrics = &v2.MetricsSpec{
+			Enabled: metrics.Enabled,
+			Image:   metrics.Image,
+		}
+	}
+	if policy := spec.CommandPolicy; policy != nil {
+		dst.Spec.CommandPolicy = &v2.CommandPolicySpec{
+			Disabled: policy.Disabled,
+			Renamed:  policy.Renamed,
+		}
+	}
+	if policy := spec.NetworkPolicy; policy != nil {
+		dst.Spec.NetworkPolicy = &v2.NetworkPolicySpec{
+			MetricsNamespace: policy.MetricsNamespace,
+		}
+		for _, peer := range policy.Clients {
+			dst.Spec.NetworkPolicy.Clients = append(dst.Spec.NetworkPolicy.Clients, v2.NetworkPolicyPeer{
+				NamespaceSelector: peer.NamespaceSelector,
+				PodSelector:       peer.PodSelector,
+			})
+		}
+	}
+
+	status := r.Status.DeepCopy()
+	dst.Status = v2.RedisStatus{
+		Status:           v2.Status(status.Status),
+		Master:           status.Master,
+		Version:          status.Version,
+		Replicas:         status.Replicas,
+		ConnectedClients: status.ConnectedClients,
+		Selector:         status.Selector,
+		Binding:          status.Binding,
+		Conditions:       status.Conditions,
+	}
+	for _, module := range status.Modules {
+		dst.Status.Modules = append(dst.Status.Modules, v2.ModuleStatus{
+			Name:    module.Name,
+			Version: module.Version,
+		})
+	}
+	if upgrade := status.Upgrade; upgrade != nil {
+		dst.Status.Upgrade = &v2.UpgradeStatus{
+			From:  upgrade.From,
+			To:    upgrade.To,
+			Phase: v2.UpgradePhase(upgrade.Phase),
+		}
+	}
+
+	services := serviceSpelling{
+		Service:  spec.Service,
+		Master:   spec.Master.Service,
+		Replicas: spec.Replicas.Service,
+	}
+	dst.Spec.Master.Service, dst.Spec.Replicas.Service = services.resolve()
+
+	// restore the replica service of objects written before v1 had per
+	// role services
+	if data, ok := dst.Annotations[ConversionDataAnnotation]; ok {
+		delete(dst.Annotations, ConversionDataAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+		restored := conversionData{}
+		if err := json.Unmarshal([]byte(data), &restored); err != nil {
+			return err
+		}
+		dst.Spec.Replicas.Service = restored.ReplicasService
+	}
+
+	// keep the spelling of the services when v2 reads back another one
+	if apiequality.Semantic.DeepEqual(services, spellServices(dst.Spec.Master.Service, dst.Spec.Replicas.Service)) {
+		return nil
+	}
+	data, err := json.Marshal(conversionData{Services: &services})
+	if err != nil {
+		return err
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[ConversionDataAnnotation] = string(data)
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this Redis
+func (r *Redis) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v2.Redis)
+	r.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	spec := src.Spec.DeepCopy()
+	r.Spec = RedisSpec{
+		Mode:        RedisMode(spec.Mode),
+		ClusterSize: spec.ClusterSize,
+		LogLevel:    RedisLogLevel(spec.LogLevel),
+		Databases:   spec.Databases,
+		Config:      spec.Config,
+		Engine:      RedisEngine(spec.Engine),
+		Version:     spec.Version,
+		Port:        spec.Port,
+		Paused:      spec.Paused,
+
+		PodSecurityContext:       spec.PodSecurityContext,
+		ContainerSecurityContext: spec.ContainerSecurityContext,
+		PodTemplate:              spec.PodTemplate,
+		Master: RoleSpec{
+			Resources:    spec.Master.Resources,
+			Persistence:  convertPersistenceFrom(spec.Master.Persistence),
+			Config:       spec.Master.Config,
+			NodeSelector: spec.Master.NodeSelector,
+			Tolerations:  spec.Master.Tolerations,
+			Affinity:     spec.Master.Affinity,
+		},
+		Replicas: RoleSpec{
+			Resources:    spec.Replicas.Resources,
+			Persistence:  convertPersistenceFrom(spec.Replicas.Persistence),
+			Config:       spec.Replicas.Config,
+			NodeSelector: spec.Replicas.NodeSelector,
+			Tolerations:  spec.Replicas.Tolerations,
+			Affinity:     spec.Replicas.Affinity,
+		},
+		Binding: BindingSpec{
+			ConfigMap: spec.Binding.ConfigMap,
+		},
+	}
+	if probes := spec.Probes; probes != nil {
+		r.Spec.Probes = &ProbesSpec{
+			Startup:   convertProbeFrom(probes.Startup),
+			Liveness:  convertProbeFrom(probes.Liveness),
+			Readiness: convertProbeFrom(probes.Readiness),
+		}
+	}
+	for _, module := range spec.Modules {
+		r.Spec.Modules = append(r.Spec.Modules, ModuleSpec{
+			Name:  ModuleName(module.Name),
+			Path:  module.Path,
+			Image: module.Image,
+			Args:  module.Args,
+		})
+	}
+	if restore := spec.Persistence.RestoreFrom; restore != nil {
+		r.Spec.RestoreFrom = &RestoreSource{
+			URL:        restore.URL,
+			SHA256:     restore.SHA256,
+			SecretName: restore.SecretName,
+		}
+	}
+	if auth := spec.Auth; auth != nil {
+		r.Spec.Auth = &AuthSpec{
+			SecretName: auth.SecretName,
+			SecretKey:  auth.SecretKey,
+		}
+	}
+	if metrics := spec.Metrics; metrics != nil {
+		r.Spec.Metrics = &MetricsSpec{
+			Enabled: metrics.Enabled,
+			Image:   metrics.Image,
+		}
+	}
+	if policy := spec.CommandPolicy; policy != nil {
+		r.Spec.CommandPolicy = &CommandPolicySpec{
+			Disabled: policy.Disabled,
+			Renamed:  policy.Renamed,
+		}
+	}
+	if policy := spec.NetworkPolicy; policy != nil {
+		r.Spec.NetworkPolicy = &NetworkPolicySpec{
+			MetricsNamespace: policy.MetricsNamespace,
+		}
+		for _, peer := range policy.Clients {
+			r.Spec.NetworkPolicy.Clients = append(r.Spec.NetworkPolicy.Clients, NetworkPolicyPeer{
+				NamespaceSelector: peer.NamespaceSelector,
+				PodSelector:       peer.PodSelector,
+			})
+		}
+	}
+
+	status := src.Status.DeepCopy()
+	r.Status = RedisStatus{
+		Status:           Status(status.Status),
+		Master:           status.Master,
+		Version:          status.Version,
+		Replicas:         status.Replicas,
+		ConnectedClients: status.ConnectedClients,
+		Selector:         status.Selector,
+		Binding:          status.Binding,
+		Conditions:       status.Conditions,
+	}
+	for _, module := range status.Modules {
+		r.Status.Modules = append(r.Status.Modules, ModuleStatus{
+			Name:    module.Name,
+			Version: module.Version,
+		})
+	}
+	if upgrade := status.Upgrade; upgrade != nil {
+		r.Status.Upgrade = &UpgradeStatus{
+			From:  upgrade.From,
+			To:    upgrade.To,
+			Phase: UpgradePhase(upgrade.Phase),
+		}
+	}
+
+	// the spelling of the services kept by ConvertTo is used as long as it
+	// still resolves to the services of the hub
+	services := spellServices(spec.Master.Service, spec.Replicas.Service)
+	if data, ok := r.Annotations[ConversionDataAnnotation]; ok {
+		delete(r.Annotations, ConversionDataAnnotation)
+		if len(r.Annotations) == 0 {
+			r.Annotations = nil
+		}
+		restored := conversionData{}
+		if err := json.Unmarshal([]byte(data), &restored); err != nil {
+			return err
+		}
+		if kept := restored.Services; kept != nil {
+			master, replicas := kept.resolve()
+			if apiequality.Semantic.DeepEqual(master, spec.Master.Service) && apiequality.Semantic.DeepEqual(replicas, spec.Replicas.Service) {
+				services = *kept
+			}
+		}
+	}
+	r.Spec.Service = services.Service
+	r.Spec.Master.Service = services.Master
+	r.Spec.Replicas.Service = services.Replicas
+	return nil
+}
+
+// convertPersistenceTo used to convert the persistence of a role to the hub
+func convertPersistenceTo(p *RolePersistenceSpec) *v2.RolePersistenceSpec {
+	if p == nil {
+		return nil
+	}
+	p = p.DeepCopy()
+	return &v2.RolePersistenceSpec{
+		AppendOnly: p.AppendOnly,
+		Snapshots:  p.Snapshots,
+	}
+}
+
+// convertPersistenceFrom used to convert the hub persistence of a role to v1
+func convertPersistenceFrom(p *v2.RolePersistenceSpec) *RolePersistenceSpec {
+	if p == nil {
+		return nil
+	}
+	p = p.DeepCopy()
+	return &RolePersistenceSpec{
+		AppendOnly: p.AppendOnly,
+		Snapshots:  p.Snapshots,
+	}
+}
+
+// convertProbeTo used to convert the timings of a probe to the hub
+func convertProbeTo(p *ProbeSpec) *v2.ProbeSpec {
+	if p == nil {
+		return nil
+	}
+	return &v2.ProbeSpec{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+}
+
+// convertProbeFrom used to convert the hub timings of a probe to v1
+func convertProbeFrom(p *v2.ProbeSpec) *ProbeSpec {
+	if p == nil {
+		return nil
+	}
+	return &ProbeSpec{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+}
+
+// convertServiceTo used to convert the v1 service exposure to the hub
+func convertServiceTo(svc *ServiceSpec) *v2.ServiceSpec {
+	if svc == nil {
+		return nil
+	}
+	svc = svc.DeepCopy()
+	return &v2.ServiceSpec{
+		Type:                  svc.Type,
+		Annotations:           svc.Annotations,
+		ExternalTrafficPolicy: svc.ExternalTrafficPolicy,
+	}
+}
+
+// convertServiceFrom used to convert the hub service exposure to v1
+func convertServiceFrom(svc *v2.ServiceSpec) *ServiceSpec {
+	if svc == nil {
+		return nil
+	}
+	svc = svc.DeepCopy()
+	return &ServiceSpec{
+		Type:                  svc.Type,
+		Annotations:           svc.Annotations,
+		ExternalTrafficPolicy: svc.ExternalTrafficPolicy,
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"math/rand"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	v2 "github.com/spazzy757/simple-redis/api/v2"
+)
+
+// conversionFuzzer used to fill both versions with random but valid objects
+func conversionFuzzer(t *testing.T) *fuzz.Fuzzer {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fuzzer.FuzzerFor(metafuzzer.Funcs, rand.NewSource(rand.Int63()), serializer.NewCodecFactory(scheme))
+}
+
+func TestFuzzyConversion(t *testing.T) {
+	f := conversionFuzzer(t)
+
+	t.Run("v1 to v2 and back", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			before := &Redis{}
+			f.Fuzz(before)
+
+			hub := &v2.Redis{}
+			if err := before.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatal(err)
+			}
+			after := &Redis{}
+			if err := after.ConvertFrom(hub); err != nil {
+				t.Fatal(err)
+			}
+			if !apiequality.Semantic.DeepEqual(before, after) {
+				t.Fatalf("round trip changed the object: %s", diff.ObjectReflectDiff(before, after))
+			}
+		}
+	})
+
+	t.Run("v2 to v1 and back", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			before := &v2.Redis{}
+			f.Fuzz(before)
+
+			spoke := &Redis{}
+			if err := spoke.ConvertFrom(before.DeepCopy()); err != nil {
+				t.Fatal(err)
+			}
+			after := &v2.Redis{}
+			if err := spoke.ConvertTo(after); err != nil {
+				t.Fatal(err)
+			}
+			if !apiequality.Semantic.DeepEqual(before, after) {
+				t.Fatalf("round trip changed the object: %s", diff.ObjectReflectDiff(before, after))
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// directiveKind describes how the value of a config directive is checked
+type directiveKind int
+
+const (
+	// directiveString accepts any value without control characters
+	directiveString directiveKind = iota
+	// directiveBool accepts yes or no
+	directiveBool
+	// directiveInt accepts an integer between min and max
+	directiveInt
+	// directiveMemory accepts a byte size with an optional unit, e.g. 100mb
+	directiveMemory
+	// directiveEnum accepts one of values
+	directiveEnum
+)
+
+// directive is the catalogue entry of a redis config directive
+type directive struct {
+	kind     directiveKind
+	min, max int64
+	values   []string
+	// since is the first release line supporting the directive, empty when
+	// every supported release line does
+	since string
+	// engine is the only engine supporting the directive, empty when every
+	// engine does
+	engine RedisEngine
+}
+
+// maxInt is the upper bound of the integer directives without one of their
+// own
+const maxInt = 1<<31 - 1
+
+// directives is the catalogue of the redis config directives that can be set
+// through spec.config
+var directives = map[string]directive{
+	"activedefrag":              {kind: directiveBool},
+	"appendfsync":               {kind: directiveEnum, values: []string{"always", "everysec", "no"}},
+	"appendonly":                {kind: directiveBool},
+	"hz":                        {kind: directiveInt, min: 1, max: 500},
+	"io-threads":                {kind: directiveInt, min: 1, max: 128, since: "6.0"},
+	"io-threads-do-reads":       {kind: directiveBool, since: "6.0"},
+	"latency-monitor-threshold": {kind: directiveInt, min: 0, max: maxInt},
+	"latency-tracking":          {kind: directiveBool, since: "7.0"},
+	"lazyfree-lazy-eviction":    {kind: directiveBool},
+	"lazyfree-lazy-expire":      {kind: directiveBool},
+	"lazyfree-lazy-server-del":  {kind: directiveBool},
+	"lazyfree-lazy-user-del":    {kind: directiveBool, since: "6.0"},
+	"lazyfree-lazy-user-flush":  {kind: directiveBool, since: "6.2"},
+	"list-max-listpack-size":    {kind: directiveInt, min: -5, max: maxInt, since: "7.0"},
+	"list-max-ziplist-size":     {kind: directiveInt, min: -5, max: maxInt},
+	"maxclients":                {kind: directiveInt, min: 1, max: maxInt},
+	"maxmemory":                 {kind: directiveMemory},
+	"maxmemory-clients":         {kind: directiveMemory, since: "7.0"},
+	"maxmemory-policy":          {kind: directiveEnum, values: []string{"volatile-lru", "allkeys-lru", "volatile-lfu", "allkeys-lfu", "volatile-random", "allkeys-random", "volatile-ttl", "noeviction"}},
+	"maxmemory-samples":         {kind: directiveInt, min: 1, max: 64},
+	"min-replicas-max-lag":      {kind: directiveInt, min: 0, max: maxInt},
+	"min-replicas-to-write":     {kind: directiveInt, min: 0, max: maxInt},
+	"notify-keyspace-events":    {kind: directiveString},
+	"repl-backlog-size":         {kind: directiveMemory},
+	"repl-diskless-sync":        {kind: directiveBool},
+	"save":                      {kind: directiveString},
+	"server-threads":            {kind: directiveInt, min: 1, max: 64, engine: EngineKeyDB},
+	"slowlog-log-slower-than":   {kind: directiveInt, min: -1, max: maxInt},
+	"slowlog-max-len":           {kind: directiveInt, min: 0, max: maxInt},
+	"stream-node-max-bytes":     {kind: directiveMemory},
+	"tcp-keepalive":             {kind: directiveInt, min: 0, max: maxInt},
+	"timeout":                   {kind: directiveInt, min: 0, max: maxInt},
+}
+
+// reservedDirectives are rendered by the operator from the spec and cannot be
+// overridden through spec.config
+var reservedDirectives = map[string]string{
+	"bind":           "the operator",
+	"databases":      "spec.databases",
+	"dir":            "the operator",
+	"loglevel":       "spec.logLevel",
+	"loadmodule":     "spec.modules",
+	"masterauth":     "spec.auth",
+	"masteruser":     "spec.commandPolicy",
+	"port":           "spec.port",
+	"replicaof":      "the operator",
+	"rename-command": "spec.commandPolicy",
+	"requirepass":    "spec.auth",
+	"slaveof":        "the operator",
+	"user":           "spec.commandPolicy",
+}
+
+// memoryValue matches the byte sizes redis accepts
+var memoryValue = regexp.MustCompile(`^(?i)[0-9]+(b|k|kb|m|mb|g|gb)?$`)
+
+// validateDirective used to check a config directive against the catalogue
+// for the engine and the redis version it is compatible with
+func validateDirective(name, value string, engine RedisEngine, version string) error {
+	// redis-server joins its arguments into config lines, a line break
+	// would smuggle in further directives past the catalogue
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%v must not contain control characters", name)
+	}
+	if owner, ok := reservedDirectives[name]; ok {
+		return fmt.Errorf("%v is managed by %v", name, owner)
+	}
+	d, ok := directives[name]
+	if !ok {
+		return fmt.Errorf("unknown directive %v", name)
+	}
+	if d.engine != "" && d.engine != engineOrDefault(engine) {
+		return fmt.Errorf("%v is only supported by %v", name, d.engine)
+	}
+	if d.since != "" && compareReleaseLines(releaseLine(version), d.since) < 0 {
+		return fmt.Errorf("%v requires redis %v or later", name, d.since)
+	}
+	switch d.kind {
+	case directiveBool:
+		if value != "yes" && value != "no" {
+			return fmt.Errorf("%v needs to be yes or no", name)
+		}
+	case directiveInt:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || i < d.min || i > d.max {
+			return fmt.Errorf("%v needs to be an integer between %v and %v", name, d.min, d.max)
+		}
+	case directiveMemory:
+		if !memoryValue.MatchString(value) {
+			return fmt.Errorf("%v needs to be a size in bytes, optionally with a k, kb, m, mb, g or gb unit", name)
+		}
+	case directiveEnum:
+		for _, v := range d.values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v needs to be one of %v", name, d.values)
+	}
+	return nil
+}
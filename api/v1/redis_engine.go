@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// engineReleases maps the release lines of the engines forked from redis to
+// the redis release line they are compatible with, the directives, commands
+// and RDB format available follow that release line
+var engineReleases = map[RedisEngine]map[string]string{
+	EngineValkey: {
+		"7.2": "7.2",
+		"8.0": "7.2",
+		"8.1": "7.2",
+	},
+	EngineKeyDB: {
+		"6.2": "6.2",
+		"6.3": "6.2",
+	},
+}
+
+// defaultEngineVersions are deployed when no version is given for an engine
+// other than redis
+var defaultEngineVersions = map[RedisEngine]string{
+	EngineValkey: "8.0.1",
+	EngineKeyDB:  "6.3.4",
+}
+
+// CompatibleVersion used to get the redis version a version of the engine is
+// compatible with, redis versions and unknown releases are returned as is
+func CompatibleVersion(engine RedisEngine, version string) string {
+	if line, ok := engineReleases[engine][releaseLine(version)]; ok {
+		return line
+	}
+	return version
+}
+
+// compatibleVersion used to get the redis version the spec is compatible with
+func (r *Redis) compatibleVersion() string {
+	version := r.Spec.Version
+	if version == "" {
+		version = DefaultVersion
+	}
+	return CompatibleVersion(r.Spec.Engine, version)
+}
+
+// engineOrDefault used to get the engine of an instance, instances created
+// before the engine could be chosen run redis
+func engineOrDefault(engine RedisEngine) RedisEngine {
+	if engine == "" {
+		return EngineRedis
+	}
+	return engine
+}
+
+// validateEngineVersion used to validate the version is a known release of
+// the engine
+func (r *Redis) validateEngineVersion() *field.Error {
+	releases, ok := engineReleases[r.Spec.Engine]
+	if !ok {
+		return nil
+	}
+	if _, ok := releases[releaseLine(r.Spec.Version)]; !ok {
+		return field.Invalid(
+			field.NewPath("spec").Child("version"),
+			r.Spec.Version,
+			fmt.Sprintf("unsupported %v version %v", r.Spec.Engine, r.Spec.Version),
+		)
+	}
+	return nil
+}
+
+// validateEngineChange used to refuse changing the engine, the data of the
+// running instance would have to be migrated
+func (r *Redis) validateEngineChange(old *Redis) *field.Error {
+	if engineOrDefault(r.Spec.Engine) == engineOrDefault(old.Spec.Engine) {
+		return nil
+	}
+	return field.Forbidden(
+		field.NewPath("spec").Child("engine"),
+		"the engine cannot be changed, create a new instance restored from a backup of this one instead",
+	)
+}
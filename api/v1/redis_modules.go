@@ -0,0 +1,189 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// moduleDir is the directory the pre-built module images keep the module
+// shared objects in
+const moduleDir = "/usr/lib/redis/modules"
+
+// module is the catalogue entry of a redis module
+type module struct {
+	// file is the shared object of the module in moduleDir
+	file string
+	// releases maps the release lines of the module to the first redis
+	// release line they load on
+	releases map[string]string
+}
+
+// modules is the catalogue of the redis modules that can be loaded through
+// spec.modules
+var modules = map[ModuleName]module{
+	ModuleJSON: {
+		file: "rejson.so",
+		releases: map[string]string{
+			"2.0": "6.0",
+			"2.2": "6.0",
+			"2.4": "6.0",
+			"2.6": "7.2",
+		},
+	},
+	ModuleSearch: {
+		file: "redisearch.so",
+		releases: map[string]string{
+			"2.0": "6.0",
+			"2.2": "6.0",
+			"2.4": "6.0",
+			"2.6": "6.0",
+			"2.8": "7.2",
+		},
+	},
+	ModuleBloom: {
+		file: "redisbloom.so",
+		releases: map[string]string{
+			"2.2": "5.0",
+			"2.4": "6.0",
+			"2.6": "7.2",
+		},
+	},
+	ModuleTimeSeries: {
+		file: "redistimeseries.so",
+		releases: map[string]string{
+			"1.4":  "5.0",
+			"1.6":  "6.0",
+			"1.8":  "6.0",
+			"1.10": "7.2",
+		},
+	},
+}
+
+// moduleTag matches the release line at the start of a module image tag, for
+// example 2.4 in v2.4.7-bullseye
+var moduleTag = regexp.MustCompile(`^v?([0-9]+\.[0-9]+)`)
+
+// imageTag used to get the tag of an image reference, empty when the image is
+// only referenced by digest or without a tag
+func imageTag(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	return image[i+1:]
+}
+
+// defaultModules used to default the path of modules shipped in a pre-built
+// image
+func (r *Redis) defaultModules() {
+	for i := range r.Spec.Modules {
+		m := &r.Spec.Modules[i]
+		if entry, ok := modules[m.Name]; ok && m.Path == "" && m.Image != "" {
+			m.Path = path.Join(moduleDir, entry.file)
+		}
+	}
+}
+
+// validateModules used to validate the modules and check the release of the
+// pre-built module images loads on the redis version
+func (r *Redis) validateModules() field.ErrorList {
+	var errs field.ErrorList
+	modulesPath := field.NewPath("spec").Child("modules")
+	seen := map[ModuleName]bool{}
+	for i, m := range r.Spec.Modules {
+		p := modulesPath.Index(i)
+		entry, ok := modules[m.Name]
+		if !ok {
+			errs = append(errs, field.NotSupported(p.Child("name"), m.Name, moduleNames()))
+			continue
+		}
+		if seen[m.Name] {
+			errs = append(errs, field.Duplicate(p.Child("name"), m.Name))
+		}
+		seen[m.Name] = true
+		switch {
+		case m.Path == "" && m.Image == "":
+			errs = append(errs, field.Required(p.Child("path"), "either the path of the module in the redis image or an image with the module is needed"))
+		case m.Path != "" && !path.IsAbs(m.Path):
+			errs = append(errs, field.Invalid(p.Child("path"), m.Path, "needs to be an absolute path"))
+		case !singleWord(m.Path):
+			errs = append(errs, field.Invalid(p.Child("path"), m.Path, "must not contain whitespace or control characters"))
+		}
+		// the path and args are joined into a single loadmodule directive
+		for j, arg := range m.Args {
+			if arg == "" || !singleWord(arg) {
+				errs = append(errs, field.Invalid(p.Child("args").Index(j), arg, "needs to be a single word without whitespace or control characters"))
+			}
+		}
+		if m.Image == "" {
+			continue
+		}
+		match := moduleTag.FindStringSubmatch(imageTag(m.Image))
+		if match == nil {
+			errs = append(errs, field.Invalid(p.Child("image"), m.Image, "needs a version tag to check the module supports the redis version"))
+			continue
+		}
+		since, ok := entry.releases[match[1]]
+		switch {
+		case !ok:
+			errs = append(errs, field.Invalid(p.Child("image"), m.Image, fmt.Sprintf("unknown %v release %v, known releases are %v", m.Name, match[1], moduleReleases(entry))))
+		case !AtLeast(r.compatibleVersion(), since):
+			errs = append(errs, field.Invalid(p.Child("image"), m.Image, fmt.Sprintf("%v %v requires redis %v or later", m.Name, match[1], since)))
+		}
+	}
+	return errs
+}
+
+// singleWord used to check that a value stays a single word once joined into
+// a config directive
+func singleWord(value string) bool {
+	return strings.IndexFunc(value, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) < 0
+}
+
+// moduleNames used to list the modules of the catalogue
+func moduleNames() []string {
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// moduleReleases used to list the known release lines of a module, oldest
+// first
+func moduleReleases(entry module) []string {
+	releases := make([]string, 0, len(entry.releases))
+	for line := range entry.releases {
+		releases = append(releases, line)
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		return compareReleaseLines(releases[i], releases[j]) < 0
+	})
+	return releases
+}
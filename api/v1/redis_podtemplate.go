@@ -0,0 +1,147 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// operatorLabelPrefix prefixes the labels the operator selects the pods of an
+// instance by
+const operatorLabelPrefix = "simple.simple.redis/"
+
+// operatorContainers are generated by the operator, the pod template can only
+// add env vars and volume mounts to them
+var operatorContainers = map[string]bool{
+	"redis":   true,
+	"metrics": true,
+	"restore": true,
+}
+
+// moduleContainerPrefix prefixes the init containers copying the modules of
+// spec.modules into the redis pods
+const moduleContainerPrefix = "module-"
+
+// operatorVolumes hold the redis working directory, the writable /tmp next
+// to the read only root filesystem and the modules copied from their images
+var operatorVolumes = map[string]string{
+	"data":    "/data",
+	"tmp":     "/tmp",
+	"modules": "/modules",
+}
+
+// operatorEnv are the env vars the operator passes the credentials and the
+// restore source in
+var operatorEnv = map[string]bool{
+	"REDIS_PASSWORD":       true,
+	"REDISCLI_AUTH":        true,
+	"REDIS_ADMIN_PASSWORD": true,
+	"REDIS_ADDR":           true,
+	"REDIS_USER":           true,
+	"RESTORE_URL":          true,
+	"RESTORE_SHA256":       true,
+}
+
+// validatePodTemplate used to validate the pod template only adds to the
+// generated pod template and leaves the fields owned by the operator alone
+func (r *Redis) validatePodTemplate() field.ErrorList {
+	template := r.Spec.PodTemplate
+	if template == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("podTemplate")
+	for key := range template.Labels {
+		if strings.HasPrefix(key, operatorLabelPrefix) {
+			errs = append(errs, field.Forbidden(path.Child("metadata", "labels").Key(key), "labels with the prefix "+operatorLabelPrefix+" are set by the operator"))
+		}
+	}
+
+	spec := path.Child("spec")
+	if template.Spec.SecurityContext != nil {
+		errs = append(errs, field.Forbidden(spec.Child("securityContext"), "use spec.podSecurityContext instead"))
+	}
+	if len(template.Spec.ReadinessGates) > 0 {
+		errs = append(errs, field.Forbidden(spec.Child("readinessGates"), "the operator gates readiness on the replication sync"))
+	}
+	errs = append(errs, validateTemplateContainers(spec.Child("initContainers"), template.Spec.InitContainers)...)
+	errs = append(errs, validateTemplateContainers(spec.Child("containers"), template.Spec.Containers)...)
+	for i, volume := range template.Spec.Volumes {
+		p := spec.Child("volumes").Index(i).Child("name")
+		switch {
+		case volume.Name == "":
+			errs = append(errs, field.Required(p, "volumes are merged by name"))
+		case operatorVolumes[volume.Name] != "":
+			errs = append(errs, field.Forbidden(p, fmt.Sprintf("volume %v is managed by the operator", volume.Name)))
+		}
+	}
+	return errs
+}
+
+// validateTemplateContainers used to validate the sidecars are complete and
+// the operator containers are only extended with env vars and volume mounts
+func validateTemplateContainers(path *field.Path, containers []corev1.Container) field.ErrorList {
+	var errs field.ErrorList
+	for i, c := range containers {
+		p := path.Index(i)
+		if c.Name == "" {
+			errs = append(errs, field.Required(p.Child("name"), "containers are merged by name"))
+			continue
+		}
+		if c.SecurityContext != nil {
+			errs = append(errs, field.Forbidden(p.Child("securityContext"), "use spec.containerSecurityContext instead"))
+		}
+		if strings.HasPrefix(c.Name, moduleContainerPrefix) {
+			errs = append(errs, field.Forbidden(p.Child("name"), "containers with the prefix "+moduleContainerPrefix+" copy the modules of spec.modules"))
+			continue
+		}
+		if !operatorContainers[c.Name] {
+			if c.Image == "" {
+				errs = append(errs, field.Required(p.Child("image"), "containers added to the redis pods need an image"))
+			}
+			continue
+		}
+
+		rest := c.DeepCopy()
+		rest.Name = ""
+		rest.Env = nil
+		rest.EnvFrom = nil
+		rest.VolumeMounts = nil
+		rest.SecurityContext = nil
+		if !equality.Semantic.DeepEqual(*rest, corev1.Container{}) {
+			errs = append(errs, field.Forbidden(p, fmt.Sprintf("only env, envFrom and volumeMounts of the operator container %v can be set", c.Name)))
+		}
+		for j, env := range c.Env {
+			if operatorEnv[env.Name] {
+				errs = append(errs, field.Forbidden(p.Child("env").Index(j).Child("name"), fmt.Sprintf("env var %v is set by the operator", env.Name)))
+			}
+		}
+		for j, mount := range c.VolumeMounts {
+			for volume, dir := range operatorVolumes {
+				if mount.MountPath == dir {
+					errs = append(errs, field.Forbidden(p.Child("volumeMounts").Index(j).Child("mountPath"), fmt.Sprintf("%v holds the %v volume of the operator", dir, volume)))
+				}
+			}
+		}
+	}
+	return errs
+}
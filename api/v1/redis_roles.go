@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"sort"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// RoleConfig used to get the config directives a role runs with: spec.config
+// overridden by the directives and the persistence of the role
+func (s *RedisSpec) RoleConfig(role RoleSpec) map[string]string {
+	config := make(map[string]string, len(s.Config)+len(role.Config))
+	for name, value := range s.Config {
+		config[name] = value
+	}
+	for name, value := range role.Config {
+		config[name] = value
+	}
+	if p := role.Persistence; p != nil {
+		if p.AppendOnly != nil {
+			config["appendonly"] = yesNo(*p.AppendOnly)
+		}
+		// an empty save directive removes the default save points
+		if p.Snapshots != nil && !*p.Snapshots {
+			config["save"] = `""`
+		}
+	}
+	return config
+}
+
+// RoleService used to get the exposure of the service of a role
+func (s *RedisSpec) RoleService(role RoleSpec) *ServiceSpec {
+	if role.Service != nil {
+		return role.Service
+	}
+	return s.Service
+}
+
+// RolesOverridden used to check whether the master or the replicas run with
+// their own settings, the master role then belongs to the master deployment
+func (s *RedisSpec) RolesOverridden() bool {
+	return !apiequality.Semantic.DeepEqual(s.Master, RoleSpec{}) ||
+		!apiequality.Semantic.DeepEqual(s.Replicas, RoleSpec{})
+}
+
+// yesNo used to render a boolean config directive
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// validateRoles used to validate the config directives of the roles and
+// that their persistence does not conflict with them
+func (r *Redis) validateRoles() field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if r.Spec.Mode == ModeStandalone && !apiequality.Semantic.DeepEqual(r.Spec.Replicas, RoleSpec{}) {
+		errs = append(errs, field.Forbidden(spec.Child("replicas"), "standalone instances have no replicas"))
+	}
+	errs = append(errs, r.validateRole(spec.Child("master"), r.Spec.Master)...)
+	return append(errs, r.validateRole(spec.Child("replicas"), r.Spec.Replicas)...)
+}
+
+// validateRole used to validate the overrides of a single role
+func (r *Redis) validateRole(path *field.Path, role RoleSpec) field.ErrorList {
+	var errs field.ErrorList
+	names := make([]string, 0, len(role.Config))
+	for name := range role.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := role.Config[name]
+		if err := validateDirective(name, value, r.Spec.Engine, r.compatibleVersion()); err != nil {
+			errs = append(errs, field.Invalid(path.Child("config").Key(name), value, err.Error()))
+		}
+	}
+
+	p := role.Persistence
+	if p == nil {
+		return errs
+	}
+	conflicts := []struct {
+		set       bool
+		directive string
+		field     string
+	}{
+		{p.AppendOnly != nil, "appendonly", "appendOnly"},
+		{p.Snapshots != nil, "save", "snapshots"},
+	}
+	for _, c := range conflicts {
+		if !c.set {
+			continue
+		}
+		if _, ok := r.Spec.Config[c.directive]; ok {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", "config").Key(c.directive), "set by "+path.Child("persistence", c.field).String()))
+		}
+		if _, ok := role.Config[c.directive]; ok {
+			errs = append(errs, field.Forbidden(path.Child("config").Key(c.directive), "set by "+path.Child("persistence", c.field).String()))
+		}
+	}
+	return errs
+}
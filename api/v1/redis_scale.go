@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// scaleValidatePath is the path the scale subresource is validated on
+const scaleValidatePath = "/validate-simple-simple-redis-v1-redis-scale"
+
+//+kubebuilder:webhook:path=/validate-simple-simple-redis-v1-redis-scale,mutating=false,failurePolicy=fail,sideEffects=None,groups=simple.simple.redis,resources=redis/scale,verbs=update,versions=v1;v2,name=vredis-scale.kb.io,admissionReviewVersions=v1
+
+// scaleValidator validates updates through the scale subresource, which
+// bypass the validation of the redis resource. The cluster size of the
+// stored instance is replaced with the requested replicas and validated as
+// an update of the spec, so `kubectl scale` is held to the same rules
+type scaleValidator struct {
+	reader client.Reader
+}
+
+var _ admission.Handler = &scaleValidator{}
+
+// Handle implements admission.Handler
+func (v *scaleValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	redislog.Info("validate scale", "name", req.Name)
+	var scale, oldScale autoscalingv1.Scale
+	if err := json.Unmarshal(req.Object.Raw, &scale); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := json.Unmarshal(req.OldObject.Raw, &oldScale); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	old := &Redis{}
+	if err := v.reader.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: req.Name}, old); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	old.Spec.ClusterSize = int(oldScale.Spec.Replicas)
+	r := old.DeepCopy()
+	r.Spec.ClusterSize = int(scale.Spec.Replicas)
+	if err := r.ValidateUpdate(old); err != nil {
+		var apiStatus apierrors.APIStatus
+		if errors.As(err, &apiStatus) {
+			status := apiStatus.Status()
+			return admission.Response{AdmissionResponse: admissionv1.AdmissionResponse{
+				Allowed: false,
+				Result:  &status,
+			}}
+		}
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// scaleRequest used to build the admission request of `kubectl scale`
+func scaleRequest(t *testing.T, name string, from, to int32) admission.Request {
+	raw := func(replicas int32) runtime.RawExtension {
+		b, err := json.Marshal(&autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: replicas},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: b}
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Name:        name,
+		Namespace:   "default",
+		Operation:   admissionv1.Update,
+		SubResource: "scale",
+		Object:      raw(to),
+		OldObject:   raw(from),
+	}}
+}
+
+func TestScaleValidation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	replicated := &Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis-replicated", Namespace: "default"},
+		Spec:       RedisSpec{ClusterSize: 3},
+	}
+	standalone := &Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis-standalone", Namespace: "default"},
+		Spec:       RedisSpec{Mode: ModeStandalone, ClusterSize: 1},
+	}
+	for _, r := range []*Redis{replicated, standalone} {
+		r.Default()
+	}
+	v := &scaleValidator{reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(replicated, standalone).Build()}
+
+	for _, tc := range []struct {
+		name     string
+		redis    string
+		from, to int32
+		denied   string
+	}{
+		{name: "scaling up", redis: "redis-replicated", from: 3, to: 5},
+		{name: "scaling down to a single replica", redis: "redis-replicated", from: 3, to: 2},
+		{name: "scaling down to a lone master", redis: "redis-replicated", from: 2, to: 1, denied: "would remove the last replica"},
+		{name: "scaling down to zero", redis: "redis-replicated", from: 3, to: 0, denied: "spec.clusterSize"},
+		{name: "adding replicas to a standalone instance", redis: "redis-standalone", from: 1, to: 2, denied: "standalone instances have a cluster size of 1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := v.Handle(context.Background(), scaleRequest(t, tc.redis, tc.from, tc.to))
+			if tc.denied == "" {
+				if !resp.Allowed {
+					t.Fatalf("expected scaling from %v to %v to be allowed: %v", tc.from, tc.to, resp.Result)
+				}
+				return
+			}
+			if resp.Allowed {
+				t.Fatalf("expected scaling from %v to %v to be denied", tc.from, tc.to)
+			}
+			if !strings.Contains(resp.Result.Message, tc.denied) {
+				t.Fatalf("expected %q in %q", tc.denied, resp.Result.Message)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -29,6 +30,31 @@ const (
 	StatusSuccess Status = "Success"
 )
 
+// RedisMode is the topology a redis instance is deployed in. Sentinel and
+// sharded cluster are planned as further modes and not supported yet
+// +kubebuilder:validation:Enum=standalone;replication
+type RedisMode string
+
+const (
+	// ModeStandalone runs a single redis instance without replicas
+	ModeStandalone RedisMode = "standalone"
+	// ModeReplication runs a master with replicas following it
+	ModeReplication RedisMode = "replication"
+)
+
+// RedisEngine is the redis compatible server an instance runs
+// +kubebuilder:validation:Enum=redis;valkey;keydb
+type RedisEngine string
+
+const (
+	// EngineRedis runs redis
+	EngineRedis RedisEngine = "redis"
+	// EngineValkey runs valkey, the fork of redis 7.2
+	EngineValkey RedisEngine = "valkey"
+	// EngineKeyDB runs KeyDB, the multithreaded fork of redis 6.2
+	EngineKeyDB RedisEngine = "keydb"
+)
+
 // redis log levels enum
 type RedisLogLevel string
 
@@ -39,11 +65,292 @@ const (
 	RLogLevelWarning RedisLogLevel = "warning"
 )
 
+// condition types reported on the redis status
+const (
+	// ConditionRestored reports the progress of seeding the master from
+	// spec.restoreFrom
+	ConditionRestored = "Restored"
+
+	// ConditionUpgrading reports the progress of a rolling upgrade between
+	// redis versions
+	ConditionUpgrading = "Upgrading"
+
+	// ConditionPaused is set while reconciliation is paused through
+	// spec.paused or the PausedAnnotation
+	ConditionPaused = "Paused"
+
+	// ConditionDrifted reports the generated objects that were changed
+	// out-of-band and restored during the last reconcile
+	ConditionDrifted = "Drifted"
+
+	// ConditionReconciled reports whether the last reconcile succeeded and
+	// whether a failure is retried, it is unknown while paused
+	ConditionReconciled = "Reconciled"
+)
+
+// MinReplicatedClusterSize is the smallest cluster size a replicated instance
+// can be scaled down to, a master with a single replica
+const MinReplicatedClusterSize = 2
+
+// DefaultDatabases and MaxDatabases bound the number of databases
+const (
+	DefaultDatabases = 16
+	MaxDatabases     = 256
+)
+
+// PausedAnnotation pauses reconciliation when set to "true", the same as
+// setting spec.paused
+const PausedAnnotation = "simple.simple.redis/paused"
+
+// FailoverAnnotation requests handing the master role to the named pod, the
+// operator fails over once the pod finished syncing and removes the
+// annotation once the pod is the acting master. With role overrides only pods
+// of the master deployment are accepted
+const FailoverAnnotation = "simple.simple.redis/failover-to"
+
+// phases of a rolling upgrade
+type UpgradePhase string
+
+const (
+	// UpgradePhaseReplicas upgrades the replicas one by one, waiting for
+	// each to resync before the next one is replaced
+	UpgradePhaseReplicas UpgradePhase = "UpgradingReplicas"
+	// UpgradePhaseFailover hands the master role to an upgraded replica
+	UpgradePhaseFailover UpgradePhase = "FailingOver"
+	// UpgradePhaseMaster upgrades the master deployment, its new pod syncs
+	// from the acting master
+	UpgradePhaseMaster UpgradePhase = "UpgradingMaster"
+	// UpgradePhaseFailback hands the master role back to the master
+	// deployment
+	UpgradePhaseFailback UpgradePhase = "FailingBack"
+)
+
+// UpgradeStatus tracks a rolling upgrade in progress
+type UpgradeStatus struct {
+	// From is the version running before the upgrade started
+	From string `json:"from"`
+	// To is the version being upgraded to
+	To string `json:"to"`
+	// Phase of the upgrade
+	Phase UpgradePhase `json:"phase"`
+}
+
+// RestoreSource describes where the initial dataset of a redis instance is
+// downloaded from before the master starts
+type RestoreSource struct {
+	// URL of the dump.rdb file to restore, for example a pre-signed object
+	// storage URL
+	URL string `json:"url"`
+
+	// SHA256 is the optional hex encoded checksum the downloaded file needs to
+	// match before it is loaded
+	SHA256 string `json:"sha256,omitempty"`
+
+	// SecretName is an optional secret in the same namespace whose keys are
+	// exposed as environment variables to the restore container, useful for
+	// passing object storage credentials
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// ServiceSpec configures how the master and replica services are exposed
+type ServiceSpec struct {
+	// Type of the master and replica services, one of ClusterIP, NodePort or
+	// LoadBalancer. Defaults to ClusterIP
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Annotations added to the master and replica services, for example to
+	// configure a cloud load balancer
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ExternalTrafficPolicy of the master and replica services, only valid
+	// for the NodePort and LoadBalancer types
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicyType `json:"externalTrafficPolicy,omitempty"`
+}
+
+// ProbeSpec configures the timings of a probe of the redis container, fields
+// left empty keep the defaults of the operator
+type ProbeSpec struct {
+	// InitialDelaySeconds before the probe runs the first time
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+
+	// PeriodSeconds between two runs of the probe
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds after which a run of the probe fails
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// FailureThreshold is the amount of failed runs in a row after which
+	// the probe fails
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// ProbesSpec configures the probes of the redis container
+type ProbesSpec struct {
+	// Startup probe passing once redis loaded the dataset, the liveness and
+	// readiness probes only start afterwards. Defaults to every 5 seconds
+	// for up to 30 minutes
+	Startup *ProbeSpec `json:"startup,omitempty"`
+
+	// Liveness probe restarting redis once it stops answering, loading a
+	// dataset counts as answering. Defaults to every 10 seconds, failing
+	// after 3 failed runs
+	Liveness *ProbeSpec `json:"liveness,omitempty"`
+
+	// Readiness probe passing while redis answers and, on replicas, the link
+	// to the master is up and the sync finished. Defaults to every 5
+	// seconds, failing after 3 failed runs
+	Readiness *ProbeSpec `json:"readiness,omitempty"`
+}
+
+// AuthSpec configures password authentication of the redis instances
+type AuthSpec struct {
+	// SecretName of a secret in the same namespace holding the password
+	SecretName string `json:"secretName"`
+
+	// SecretKey is the key of the password within the secret, defaults to
+	// password
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// MetricsSpec configures the prometheus exporter running next to every redis
+// instance
+type MetricsSpec struct {
+	// Enabled adds a redis_exporter sidecar serving metrics on port 9121
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Image of the exporter, defaults to the redis_exporter release the
+	// operator was built against
+	Image string `json:"image,omitempty"`
+}
+
+// CommandPolicySpec restricts the commands clients can run
+type CommandPolicySpec struct {
+	// Disabled commands clients are not allowed to run, for example
+	// FLUSHALL or KEYS. They are removed from the ACL of the default user,
+	// which also loses the administrative commands such as ACL, CONFIG and
+	// MODULE once a policy is set. The operator keeps running management
+	// commands as its own admin user
+	Disabled []string `json:"disabled,omitempty"`
+
+	// Renamed commands, mapping the command to its new name. Renaming
+	// applies to every user, the operator included
+	Renamed map[string]string `json:"renamed,omitempty"`
+}
+
+// NetworkPolicySpec restricts which pods can reach the redis instances
+type NetworkPolicySpec struct {
+	// Clients allowed to connect to the redis port. The pods of the instance
+	// and the operator can always reach each other, no other client is
+	// allowed when empty
+	Clients []NetworkPolicyPeer `json:"clients,omitempty"`
+
+	// MetricsNamespace is the namespace allowed to scrape the metrics
+	// exporter, usually the namespace prometheus runs in
+	MetricsNamespace string `json:"metricsNamespace,omitempty"`
+}
+
+// NetworkPolicyPeer selects the pods allowed to connect. Only pods of the
+// same namespace are selected when no namespace selector is given, every pod
+// of the selected namespaces when no pod selector is given
+type NetworkPolicyPeer struct {
+	// NamespaceSelector selects namespaces by their labels
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// PodSelector selects pods by their labels
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+}
+
+// BindingSpec configures the connection details published for applications
+type BindingSpec struct {
+	// ConfigMap additionally publishes the non sensitive connection details
+	// in a config map of the same name as the binding secret
+	ConfigMap bool `json:"configMap,omitempty"`
+}
+
+// RoleSpec overrides the settings of the master or of the replicas, fields
+// left empty keep the settings shared by both roles
+type RoleSpec struct {
+	// Resources of the redis container, replacing the defaults of the
+	// operator config
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Persistence configures how the role persists the dataset to disk
+	Persistence *RolePersistenceSpec `json:"persistence,omitempty"`
+
+	// Config directives merged over spec.config for this role
+	Config map[string]string `json:"config,omitempty"`
+
+	// NodeSelector the pods of this role are scheduled by
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the pods of this role
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity of the pods of this role, replacing the affinity of the
+	// operator config
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Service configures the exposure of the service of this role,
+	// replacing spec.service
+	Service *ServiceSpec `json:"service,omitempty"`
+}
+
+// RolePersistenceSpec configures how a role persists the dataset, for
+// example to only write the append only file on the replicas
+type RolePersistenceSpec struct {
+	// AppendOnly enables the append only file
+	AppendOnly *bool `json:"appendOnly,omitempty"`
+
+	// Snapshots enables RDB snapshots with the default save points of redis,
+	// false disables them
+	Snapshots *bool `json:"snapshots,omitempty"`
+}
+
+// ModuleName is a redis module of the module catalogue
+// +kubebuilder:validation:Enum=json;search;bloom;timeseries
+type ModuleName string
+
+const (
+	// ModuleJSON is RedisJSON, storing and querying JSON documents
+	ModuleJSON ModuleName = "json"
+	// ModuleSearch is RediSearch, secondary indexes and full text search
+	ModuleSearch ModuleName = "search"
+	// ModuleBloom is RedisBloom, probabilistic data structures
+	ModuleBloom ModuleName = "bloom"
+	// ModuleTimeSeries is RedisTimeSeries, time series data
+	ModuleTimeSeries ModuleName = "timeseries"
+)
+
+// ModuleSpec configures a redis module loaded on startup
+type ModuleSpec struct {
+	// Name of the module in the module catalogue
+	Name ModuleName `json:"name"`
+
+	// Path of the module shared object. Without an image the module needs
+	// to be part of the redis image, with an image it is the path within
+	// that image and defaults to the path of the pre-built module images
+	Path string `json:"path,omitempty"`
+
+	// Image holding a pre-built module, for example redislabs/rejson:2.4.7.
+	// The module is copied into the redis pods by an init container, the tag
+	// is checked against the redis releases the module supports
+	Image string `json:"image,omitempty"`
+
+	// Args passed to the module when it is loaded, one word per argument,
+	// e.g. ["ERROR_RATE", "0.01"]
+	Args []string `json:"args,omitempty"`
+}
+
 // RedisSpec defines the desired state of Redis
 type RedisSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
+	// Mode is the topology of the instance, standalone runs a single
+	// instance while replication adds replicas following the master.
+	// Defaults to replication and cannot be changed
+	Mode RedisMode `json:"mode,omitempty"`
+
 	// ClusterSize determines the amount of redis instances running
 	ClusterSize int `json:"clusterSize,omitempty"`
 
@@ -59,6 +366,108 @@ type RedisSpec struct {
 	// a different one on a per-connection basis using SELECT <dbid> where
 	// dbid is a number between 0 and 'databases'-1
 	Databases int `json:"databases,omitempty"`
+
+	// Config sets additional redis config directives, for example
+	// maxmemory or maxmemory-policy. Directives are checked against a
+	// catalogue of known directives for the running version, the ones
+	// derived from other spec fields cannot be set
+	Config map[string]string `json:"config,omitempty"`
+
+	// Modules loaded by every redis instance, rendered as loadmodule
+	// directives
+	Modules []ModuleSpec `json:"modules,omitempty"`
+
+	// Engine is the redis compatible server to run, one of redis, valkey or
+	// keydb. It selects the images, the binaries and the config directives
+	// available and cannot be changed. Defaults to redis
+	Engine RedisEngine `json:"engine,omitempty"`
+
+	// Version of the engine to run, for example 6.2.3. Changing the version
+	// triggers a rolling upgrade that upgrades the replicas first, fails over
+	// to an upgraded replica and then upgrades the master. Downgrades to a
+	// version with an older RDB format are refused
+	Version string `json:"version,omitempty"`
+
+	// Port redis listens on, used for the container, the services, the
+	// probes and replication. Defaults to 6379
+	Port int `json:"port,omitempty"`
+
+	// Probes configures the timings of the startup, liveness and readiness
+	// probes
+	Probes *ProbesSpec `json:"probes,omitempty"`
+
+	// RestoreFrom seeds the master with an existing dataset. The dump is
+	// downloaded and verified by an init container before the master starts,
+	// replicas then sync from the restored master. It only applies until the
+	// Restored condition is true
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+
+	// Service configures the exposure of the master service used for writes
+	// and the replica service used for load balanced reads, unless the role
+	// sets its own in spec.master or spec.replicas
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// Paused stops the operator from changing any resource or redis instance
+	// while it keeps updating the observed status, useful to hand edit the
+	// generated resources during an incident
+	Paused bool `json:"paused,omitempty"`
+
+	// Auth enables password authentication for clients and replication
+	Auth *AuthSpec `json:"auth,omitempty"`
+
+	// Metrics configures the prometheus exporter
+	Metrics *MetricsSpec `json:"metrics,omitempty"`
+
+	// CommandPolicy disables or renames commands for clients, it requires
+	// redis 6.0 or later for ACLs
+	CommandPolicy *CommandPolicySpec `json:"commandPolicy,omitempty"`
+
+	// NetworkPolicy restricts the access to the redis pods with network
+	// policies, any pod in the cluster can connect when not set
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// PodSecurityContext of the redis pods. Replaces the hardened default
+	// running as the redis user with the RuntimeDefault seccomp profile,
+	// which satisfies the restricted pod security standard
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// ContainerSecurityContext of every container of the redis pods,
+	// including the restore and metrics containers. Replaces the hardened
+	// default with a read only root filesystem, no privilege escalation and
+	// every capability dropped
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+
+	// PodTemplate is a partial pod template merged over the generated pod
+	// template of every role with a strategic merge patch, to add sidecars,
+	// volumes, env or annotations. Fields owned by the operator, like the
+	// redis container command or the data volume, cannot be overridden
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+
+	// Master overrides the settings of the master. With overrides the master
+	// role stays with the pod of the master deployment, a replica elected in
+	// its absence hands it back once the new pod is in sync
+	Master RoleSpec `json:"master,omitempty"`
+
+	// Replicas overrides the settings of the replicas, for example to run
+	// larger replicas dedicated to reads
+	Replicas RoleSpec `json:"replicas,omitempty"`
+
+	// Binding configures the connection secret published for applications,
+	// the secret follows the Service Binding specification and is always
+	// created
+	Binding BindingSpec `json:"binding,omitempty"`
+}
+
+// ModuleStatus is a module loaded by redis
+type ModuleStatus struct {
+	// Name the module reports, for example ReJSON or search
+	Name string `json:"name"`
+
+	// Version of the module, for example 2.4.7
+	Version string `json:"version"`
 }
 
 // RedisStatus defines the observed state of Redis
@@ -70,11 +479,45 @@ type RedisStatus struct {
 
 	// master pod name
 	Master string `json:"master,omitempty"`
+
+	// version of redis currently running, differs from spec.version while an
+	// upgrade is in progress
+	Version string `json:"version,omitempty"`
+
+	// rolling upgrade in progress
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+
+	// amount of redis instances that are ready, replicas are only counted
+	// once they finished syncing from the master
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// amount of clients connected to the master, not counting replicas and
+	// the operator itself
+	ConnectedClients int32 `json:"connectedClients,omitempty"`
+
+	// label selector matching every pod of the redis cluster, used by the
+	// scale subresource
+	Selector string `json:"selector,omitempty"`
+
+	// secret holding the connection details for applications, following
+	// the Service Binding specification for provisioned services
+	Binding *corev1.LocalObjectReference `json:"binding,omitempty"`
+
+	// modules loaded by the acting master as reported by MODULE LIST
+	Modules []ModuleStatus `json:"modules,omitempty"`
+
+	// conditions describing the observed state of the redis cluster
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
-// Redis is the Schema for the redis API
+// Redis is the Schema for the redis API, it is converted to and from the v2
+// storage version
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.clusterSize,statuspath=.status.replicas,selectorpath=.status.selector
 type Redis struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -0,0 +1,74 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultVersion is the redis version deployed when none is given
+const DefaultVersion = "6.2.3"
+
+// rdbVersions maps the supported redis release lines to the version of the RDB
+// format they write. A release can load files of its own RDB version and older
+// ones, so moving to a release line with a lower RDB version is not possible
+var rdbVersions = map[string]int{
+	"5.0": 9,
+	"6.0": 9,
+	"6.2": 9,
+	"7.0": 10,
+	"7.2": 11,
+}
+
+// releaseLine used to get the major.minor release line of a redis version
+func releaseLine(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// compareReleaseLines used to order two major.minor release lines, returning
+// a negative number when a is older than b, zero when equal and a positive
+// number when a is newer
+func compareReleaseLines(a, b string) int {
+	var aMajor, aMinor, bMajor, bMinor int
+	fmt.Sscanf(a, "%d.%d", &aMajor, &aMinor)
+	fmt.Sscanf(b, "%d.%d", &bMajor, &bMinor)
+	if aMajor != bMajor {
+		return aMajor - bMajor
+	}
+	return aMinor - bMinor
+}
+
+// RDBVersion used to look up the RDB format version written by a redis
+// version
+func RDBVersion(version string) (int, error) {
+	rdb, ok := rdbVersions[releaseLine(version)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported redis version %v", version)
+	}
+	return rdb, nil
+}
+
+// AtLeast used to check whether a redis version belongs to the given
+// major.minor release line or a newer one
+func AtLeast(version, line string) bool {
+	return compareReleaseLines(releaseLine(version), line) >= 0
+}
@@ -17,19 +17,46 @@ limitations under the License.
 package v1
 
 import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	configv1alpha1 "github.com/spazzy757/simple-redis/api/config/v1alpha1"
 )
 
 // log is for logging in this package.
 var redislog = logf.Log.WithName("redis-resource")
 
+// operatorDefaults used to get the fleet wide defaults of the operator
+// config, the built in defaults apply where it sets none
+var operatorDefaults = func() configv1alpha1.RedisDefaults {
+	return configv1alpha1.RedisDefaults{}
+}
+
+// SetOperatorDefaults used to merge the defaults of the operator config under
+// the spec when defaulting, it needs to be called before the webhook is served
+func SetOperatorDefaults(defaults func() configv1alpha1.RedisDefaults) {
+	operatorDefaults = defaults
+}
+
 func (r *Redis) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// the stored instance is read uncached, the cache of the manager may be
+	// restricted to the watched namespaces
+	mgr.GetWebhookServer().Register(scaleValidatePath, &webhook.Admission{
+		Handler: &scaleValidator{reader: mgr.GetAPIReader()},
+	})
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -44,17 +71,63 @@ var _ webhook.Defaulter = &Redis{}
 // Default implements webhook.Defaulter so a webhook will be registered for the type
 func (r *Redis) Default() {
 	redislog.Info("default", "name", r.Name)
+	defaults := operatorDefaults()
 
-	// defaults redis logs level to notice
+	// defaults redis logs level to the operator config or notice
+	if r.Spec.LogLevel == "" {
+		r.Spec.LogLevel = RedisLogLevel(defaults.LogLevel)
+	}
 	if r.Spec.LogLevel == "" {
 		r.Spec.LogLevel = RLogLevelNotice
 	}
 
+	// redis rejects 0 databases, default to the redis default of 16
+	if r.Spec.Databases == 0 {
+		r.Spec.Databases = DefaultDatabases
+	}
+
+	// instances created before the engine could be chosen run redis
+	if r.Spec.Engine == "" {
+		r.Spec.Engine = EngineRedis
+	}
+
+	// defaults to the operator config or the redis version the operator was
+	// built against, other engines to the release the operator was tested
+	// with
+	if r.Spec.Version == "" {
+		r.Spec.Version = defaultEngineVersions[r.Spec.Engine]
+	}
+	if r.Spec.Version == "" {
+		r.Spec.Version = defaults.Version
+	}
+	if r.Spec.Version == "" {
+		r.Spec.Version = DefaultVersion
+	}
+
+	// defaults to the standard redis port
+	if r.Spec.Port == 0 {
+		r.Spec.Port = 6379
+	}
+
+	// defaults the key of the password within the auth secret
+	if r.Spec.Auth != nil && r.Spec.Auth.SecretKey == "" {
+		r.Spec.Auth.SecretKey = "password"
+	}
+
 	// dont currently support scaling down to 0
 	if r.Spec.ClusterSize == 0 {
 		r.Spec.ClusterSize = 1
 	}
 
+	// instances created before the mode existed run with replication
+	if r.Spec.Mode == "" {
+		r.Spec.Mode = ModeReplication
+	}
+
+	// modules shipped in a pre-built image are found at the path of the
+	// module images
+	r.defaultModules()
+
 }
 
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
@@ -72,7 +145,14 @@ func (r *Redis) ValidateCreate() error {
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Redis) ValidateUpdate(old runtime.Object) error {
 	redislog.Info("validate update", "name", r.Name)
-	return r.validateRedis()
+	if err := r.validateRedis(); err != nil {
+		return err
+	}
+	oldRedis, ok := old.(*Redis)
+	if !ok {
+		return fmt.Errorf("expected a Redis but got a %T", old)
+	}
+	return r.validateTransition(oldRedis)
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -88,9 +168,33 @@ func (r *Redis) validateRedis() error {
 	if err := r.validateClusterSize(); err != nil {
 		allErrs = append(allErrs, err)
 	}
+	if err := r.validateMode(); err != nil {
+		allErrs = append(allErrs, err)
+	}
 	if err := r.validateLogLevel(); err != nil {
 		allErrs = append(allErrs, err)
 	}
+	if err := r.validateDatabases(); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := r.validateVersion(); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	allErrs = append(allErrs, r.validateConfig()...)
+	if err := r.validatePort(); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	allErrs = append(allErrs, r.validateRestoreFrom()...)
+	allErrs = append(allErrs, r.validateService()...)
+	if err := r.validateAuth(); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	allErrs = append(allErrs, r.validateCommandPolicy()...)
+	allErrs = append(allErrs, r.validateNetworkPolicy()...)
+	allErrs = append(allErrs, r.validatePodTemplate()...)
+	allErrs = append(allErrs, r.validateRoles()...)
+	allErrs = append(allErrs, r.validateModules()...)
+	allErrs = append(allErrs, r.validateProbes()...)
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -115,6 +219,22 @@ func (r *Redis) validateClusterSize() *field.Error {
 	return nil
 }
 
+// validateMode used to validate the mode and that standalone instances run
+// a single instance
+func (r *Redis) validateMode() *field.Error {
+	path := field.NewPath("spec").Child("mode")
+	switch r.Spec.Mode {
+	case "", ModeReplication:
+		return nil
+	case ModeStandalone:
+		if r.Spec.ClusterSize > 1 {
+			return field.Invalid(path, r.Spec.Mode, "standalone instances have a cluster size of 1, use replication for replicas")
+		}
+		return nil
+	}
+	return field.NotSupported(path, r.Spec.Mode, []string{string(ModeStandalone), string(ModeReplication)})
+}
+
 // validateLogLevel used to validate that log level is one of the
 // correct levels
 func (r *Redis) validateLogLevel() *field.Error {
@@ -123,8 +243,329 @@ func (r *Redis) validateLogLevel() *field.Error {
 		return nil
 	}
 	return field.Invalid(
-		field.NewPath("spec").Child("clusterSize"),
-		r.Name,
+		field.NewPath("spec").Child("logLevel"),
+		r.Spec.LogLevel,
 		"logLevel needs to be one of [debug,notice,verbose,warning]",
 	)
 }
+
+// validateDatabases used to validate that the number of databases is within
+// bounds, every database costs memory even when empty
+func (r *Redis) validateDatabases() *field.Error {
+	if r.Spec.Databases >= 1 && r.Spec.Databases <= MaxDatabases {
+		return nil
+	}
+	return field.Invalid(
+		field.NewPath("spec").Child("databases"),
+		r.Spec.Databases,
+		fmt.Sprintf("databases needs to be between 1 and %v", MaxDatabases),
+	)
+}
+
+// validateConfig used to validate the config directives against the
+// catalogue of known directives
+func (r *Redis) validateConfig() field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("config")
+	names := make([]string, 0, len(r.Spec.Config))
+	for name := range r.Spec.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := r.Spec.Config[name]
+		if err := validateDirective(name, value, r.Spec.Engine, r.compatibleVersion()); err != nil {
+			errs = append(errs, field.Invalid(path.Key(name), value, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateVersion used to validate that the version is one of the supported
+// release lines
+func (r *Redis) validateVersion() *field.Error {
+	if err := r.validateEngineVersion(); err != nil {
+		return err
+	}
+	if _, err := RDBVersion(r.compatibleVersion()); err != nil {
+		return field.Invalid(
+			field.NewPath("spec").Child("version"),
+			r.Spec.Version,
+			err.Error(),
+		)
+	}
+	return nil
+}
+
+// validateTransition used to run the changes between the old and the new
+// spec through validation
+func (r *Redis) validateTransition(old *Redis) error {
+	var allErrs field.ErrorList
+	if err := r.validateEngineChange(old); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := r.validateModeChange(old); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := r.validateVersionChange(old); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := r.validateScaleDown(old); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := r.validateAuthRemoval(old); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: "simple", Kind: "Redis"},
+		r.Name,
+		allErrs,
+	)
+}
+
+// validateModeChange used to refuse changing the mode, the topologies keep
+// the dataset in different objects and roles
+func (r *Redis) validateModeChange(old *Redis) *field.Error {
+	if modeOrDefault(r.Spec.Mode) == modeOrDefault(old.Spec.Mode) {
+		return nil
+	}
+	return field.Forbidden(
+		field.NewPath("spec").Child("mode"),
+		"the mode cannot be changed, create a new instance restored from a backup of this one instead",
+	)
+}
+
+// modeOrDefault used to get the mode of instances created before the mode
+// was introduced
+func modeOrDefault(mode RedisMode) RedisMode {
+	if mode == "" {
+		return ModeReplication
+	}
+	return mode
+}
+
+// validateScaleDown used to refuse scaling a replicated instance down to a
+// lone master, upgrades and failovers need an in sync replica to hand the
+// master role to
+func (r *Redis) validateScaleDown(old *Redis) *field.Error {
+	if old.Spec.ClusterSize < MinReplicatedClusterSize || r.Spec.ClusterSize >= MinReplicatedClusterSize {
+		return nil
+	}
+	return field.Forbidden(
+		field.NewPath("spec").Child("clusterSize"),
+		fmt.Sprintf("scaling down from %v to %v would remove the last replica, keep at least %v instances", old.Spec.ClusterSize, r.Spec.ClusterSize, MinReplicatedClusterSize),
+	)
+}
+
+// validateAuthRemoval used to refuse disabling authentication while clients
+// are connected, they would keep sending a password redis no longer expects
+func (r *Redis) validateAuthRemoval(old *Redis) *field.Error {
+	if old.Spec.Auth == nil || r.Spec.Auth != nil || old.Status.ConnectedClients == 0 {
+		return nil
+	}
+	return field.Forbidden(
+		field.NewPath("spec").Child("auth"),
+		fmt.Sprintf("auth cannot be removed while %v clients are connected", old.Status.ConnectedClients),
+	)
+}
+
+// validateVersionChange used to refuse downgrades to a version that cannot
+// read the RDB format written by the running version, and version changes
+// while an upgrade is still in progress
+func (r *Redis) validateVersionChange(old *Redis) *field.Error {
+	if r.Spec.Version == old.Spec.Version {
+		return nil
+	}
+	path := field.NewPath("spec").Child("version")
+	if old.Status.Upgrade != nil {
+		return field.Forbidden(
+			path,
+			fmt.Sprintf("upgrade to %v is still in progress", old.Status.Upgrade.To),
+		)
+	}
+	oldRDB, err := RDBVersion(old.compatibleVersion())
+	if err != nil {
+		// versions unknown to this operator can only be moved away from
+		return nil
+	}
+	newRDB, _ := RDBVersion(r.compatibleVersion())
+	if newRDB < oldRDB {
+		return field.Forbidden(
+			path,
+			fmt.Sprintf("downgrading from %v to %v is not possible as %v cannot load the RDB version %v files written by %v", old.Spec.Version, r.Spec.Version, r.Spec.Version, oldRDB, old.Spec.Version),
+		)
+	}
+	return nil
+}
+
+// validateProbes used to validate the probe timings are not negative, zero
+// keeps the default
+func (r *Redis) validateProbes() field.ErrorList {
+	probes := r.Spec.Probes
+	if probes == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("probes")
+	for _, probe := range []struct {
+		name string
+		spec *ProbeSpec
+	}{
+		{"startup", probes.Startup},
+		{"liveness", probes.Liveness},
+		{"readiness", probes.Readiness},
+	} {
+		p := probe.spec
+		if p == nil {
+			continue
+		}
+		timings := []struct {
+			field string
+			value int32
+		}{
+			{"initialDelaySeconds", p.InitialDelaySeconds},
+			{"periodSeconds", p.PeriodSeconds},
+			{"timeoutSeconds", p.TimeoutSeconds},
+			{"failureThreshold", p.FailureThreshold},
+		}
+		for _, t := range timings {
+			if t.value < 0 {
+				errs = append(errs, field.Invalid(path.Child(probe.name, t.field), t.value, "must not be negative"))
+			}
+		}
+	}
+	return errs
+}
+
+// validatePort used to validate that the port is a valid tcp port
+func (r *Redis) validatePort() *field.Error {
+	if r.Spec.Port >= 1 && r.Spec.Port <= 65535 {
+		return nil
+	}
+	return field.Invalid(
+		field.NewPath("spec").Child("port"),
+		r.Spec.Port,
+		"port needs to be between 1 and 65535",
+	)
+}
+
+// validateRestoreFrom used to validate that the restore source can be
+// downloaded and its checksum is a sha256 hex digest
+func (r *Redis) validateRestoreFrom() field.ErrorList {
+	src := r.Spec.RestoreFrom
+	if src == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("restoreFrom")
+	if u, err := url.Parse(src.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		errs = append(errs, field.Invalid(
+			path.Child("url"),
+			src.URL,
+			"url needs to be an http or https url",
+		))
+	}
+	if src.SHA256 != "" {
+		if b, err := hex.DecodeString(src.SHA256); err != nil || len(b) != 32 {
+			errs = append(errs, field.Invalid(
+				path.Child("sha256"),
+				src.SHA256,
+				"sha256 needs to be a hex encoded sha256 digest",
+			))
+		}
+	}
+	return errs
+}
+
+// validateService used to validate the exposure of the shared and the per
+// role services
+func (r *Redis) validateService() field.ErrorList {
+	spec := field.NewPath("spec")
+	errs := validateServiceSpec(spec.Child("service"), r.Spec.Service)
+	errs = append(errs, validateServiceSpec(spec.Child("master", "service"), r.Spec.Master.Service)...)
+	return append(errs, validateServiceSpec(spec.Child("replicas", "service"), r.Spec.Replicas.Service)...)
+}
+
+// validateServiceSpec used to validate the service type and that the
+// external traffic policy is only set for externally exposed services
+func validateServiceSpec(path *field.Path, svc *ServiceSpec) field.ErrorList {
+	if svc == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	switch svc.Type {
+	case "", corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+	default:
+		errs = append(errs, field.NotSupported(
+			path.Child("type"),
+			svc.Type,
+			[]string{
+				string(corev1.ServiceTypeClusterIP),
+				string(corev1.ServiceTypeNodePort),
+				string(corev1.ServiceTypeLoadBalancer),
+			},
+		))
+	}
+	switch svc.ExternalTrafficPolicy {
+	case "":
+	case corev1.ServiceExternalTrafficPolicyTypeCluster, corev1.ServiceExternalTrafficPolicyTypeLocal:
+		if svc.Type != corev1.ServiceTypeNodePort && svc.Type != corev1.ServiceTypeLoadBalancer {
+			errs = append(errs, field.Invalid(
+				path.Child("externalTrafficPolicy"),
+				svc.ExternalTrafficPolicy,
+				"externalTrafficPolicy can only be set for NodePort and LoadBalancer services",
+			))
+		}
+	default:
+		errs = append(errs, field.NotSupported(
+			path.Child("externalTrafficPolicy"),
+			svc.ExternalTrafficPolicy,
+			[]string{
+				string(corev1.ServiceExternalTrafficPolicyTypeCluster),
+				string(corev1.ServiceExternalTrafficPolicyTypeLocal),
+			},
+		))
+	}
+	return errs
+}
+
+// validateAuth used to validate that the auth secret is referenced by name
+func (r *Redis) validateAuth() *field.Error {
+	if r.Spec.Auth == nil || r.Spec.Auth.SecretName != "" {
+		return nil
+	}
+	return field.Required(
+		field.NewPath("spec").Child("auth").Child("secretName"),
+		"secretName is required when auth is enabled",
+	)
+}
+
+// validateNetworkPolicy used to validate the selectors of the allowed clients
+// and the metrics namespace
+func (r *Redis) validateNetworkPolicy() field.ErrorList {
+	policy := r.Spec.NetworkPolicy
+	if policy == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec").Child("networkPolicy")
+	for i, peer := range policy.Clients {
+		peerPath := path.Child("clients").Index(i)
+		if peer.NamespaceSelector == nil && peer.PodSelector == nil {
+			errs = append(errs, field.Required(peerPath, "namespaceSelector or podSelector is required"))
+		}
+		opts := metav1validation.LabelSelectorValidationOptions{}
+		errs = append(errs, metav1validation.ValidateLabelSelector(peer.NamespaceSelector, opts, peerPath.Child("namespaceSelector"))...)
+		errs = append(errs, metav1validation.ValidateLabelSelector(peer.PodSelector, opts, peerPath.Child("podSelector"))...)
+	}
+	if ns := policy.MetricsNamespace; ns != "" {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, field.Invalid(path.Child("metricsNamespace"), ns, msg))
+		}
+	}
+	return errs
+}
@@ -6,8 +6,11 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("redis webhook", func() {
@@ -38,7 +41,9 @@ var _ = Describe("redis webhook", func() {
 					LogLevel: "test",
 				},
 			}
-			Expect(k8sClient.Create(ctx, redis)).ShouldNot(Succeed())
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.logLevel"))
 		})
 		It("should create validate the cluster size", func() {
 			By("creating a redis resource")
@@ -58,6 +63,329 @@ var _ = Describe("redis webhook", func() {
 			}
 			Expect(k8sClient.Create(ctx, redis)).ShouldNot(Succeed())
 		})
+		It("should run standalone instances without replicas", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Mode:        ModeStandalone,
+					ClusterSize: 3,
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.mode"))
+		})
+		It("should validate the restore source", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					RestoreFrom: &RestoreSource{
+						URL:    "s3://bucket/dump.rdb",
+						SHA256: "not-a-digest",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).ShouldNot(Succeed())
+		})
+		It("should validate the service exposure", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Service: &ServiceSpec{
+						Type:                  corev1.ServiceTypeClusterIP,
+						ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeLocal,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).ShouldNot(Succeed())
+		})
+		It("should require the auth secret name", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Auth: &AuthSpec{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).ShouldNot(Succeed())
+		})
+		It("should validate the number of databases", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Databases: MaxDatabases + 1,
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.databases"))
+		})
+		It("should validate the config directives", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Version: "6.2.3",
+					Config: map[string]string{
+						"maxmemory":         "100mb",
+						"maxmemory-policy":  "random",
+						"maxmemory-clients": "10mb",
+						"port":              "7000",
+						"no-such-directive": "yes",
+						"save":              "900 1\nrename-command CONFIG \"\"",
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).ShouldNot(ContainSubstring("spec.config[maxmemory]"))
+			Expect(err.Error()).Should(ContainSubstring("spec.config[maxmemory-policy]"))
+			Expect(err.Error()).Should(ContainSubstring("requires redis 7.0"))
+			Expect(err.Error()).Should(ContainSubstring("managed by spec.port"))
+			Expect(err.Error()).Should(ContainSubstring("unknown directive"))
+			Expect(err.Error()).Should(ContainSubstring("save must not contain control characters"))
+		})
+		It("should validate the command policy", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Version: "5.0.14",
+					CommandPolicy: &CommandPolicySpec{
+						Disabled: []string{"FLUSHALL", "ping"},
+						Renamed: map[string]string{
+							"flushall":  "nuke",
+							"replicaof": "moveto",
+							"config":    "",
+						},
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("requires redis 6.0"))
+			Expect(err.Error()).Should(ContainSubstring("spec.commandPolicy.disabled[1]"))
+			Expect(err.Error()).Should(ContainSubstring("cannot be both disabled and renamed"))
+			Expect(err.Error()).Should(ContainSubstring("spec.commandPolicy.renamed[replicaof]"))
+			Expect(err.Error()).Should(ContainSubstring("use disabled instead"))
+			Expect(err.Error()).ShouldNot(ContainSubstring("spec.commandPolicy.disabled[0]"))
+		})
+		It("should only extend the generated pod template", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					PodTemplate: &corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels:      map[string]string{"simple.simple.redis/role": "master"},
+							Annotations: map[string]string{"sidecar.istio.io/inject": "true"},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{Name: "redis", Image: "redis:latest", Env: []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}},
+								{Name: "log-shipper"},
+							},
+							Volumes: []corev1.Volume{{Name: "data"}},
+						},
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.podTemplate.metadata.labels[simple.simple.redis/role]"))
+			Expect(err.Error()).Should(ContainSubstring("spec.podTemplate.spec.containers[0]: Forbidden"))
+			Expect(err.Error()).Should(ContainSubstring("spec.podTemplate.spec.containers[1].image"))
+			Expect(err.Error()).Should(ContainSubstring("spec.podTemplate.spec.volumes[0].name"))
+			Expect(err.Error()).ShouldNot(ContainSubstring("annotations"))
+		})
+		It("should validate the role overrides", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			appendOnly := true
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Config: map[string]string{"appendonly": "no"},
+					Replicas: RoleSpec{
+						Persistence: &RolePersistenceSpec{AppendOnly: &appendOnly},
+						Config:      map[string]string{"replicaof": "elsewhere 6379"},
+						Service:     &ServiceSpec{Type: corev1.ServiceTypeClusterIP, ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeLocal},
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.config[appendonly]: Forbidden: set by spec.replicas.persistence.appendOnly"))
+			Expect(err.Error()).Should(ContainSubstring("spec.replicas.config[replicaof]"))
+			Expect(err.Error()).Should(ContainSubstring("spec.replicas.service.externalTrafficPolicy"))
+		})
+		It("should check the modules against the catalogue", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Version: "6.2.3",
+					Modules: []ModuleSpec{
+						{Name: ModuleJSON, Image: "redislabs/rejson:2.6.6"},
+						{Name: ModuleSearch, Image: "redislabs/redisearch:latest"},
+						{Name: ModuleBloom},
+						{Name: ModuleBloom, Path: "redisbloom.so"},
+						{Name: ModuleTimeSeries, Path: "/usr/lib/redis/modules/redistimeseries.so\nrename-command CONFIG \"\"", Args: []string{"RETENTION_POLICY 0"}},
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("json 2.6 requires redis 7.2 or later"))
+			Expect(err.Error()).Should(ContainSubstring("spec.modules[1].image"))
+			Expect(err.Error()).Should(ContainSubstring("spec.modules[2].path: Required value"))
+			Expect(err.Error()).Should(ContainSubstring("spec.modules[3].name: Duplicate value"))
+			Expect(err.Error()).Should(ContainSubstring("spec.modules[3].path: Invalid value"))
+			Expect(err.Error()).Should(ContainSubstring("spec.modules[4].path: Invalid value"))
+			Expect(err.Error()).Should(ContainSubstring("spec.modules[4].args[0]: Invalid value"))
+		})
+		It("should validate the engine", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Engine:  EngineValkey,
+					Version: "6.2.3",
+					Config:  map[string]string{"server-threads": "4"},
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("unsupported valkey version 6.2.3"))
+			Expect(err.Error()).Should(ContainSubstring("server-threads is only supported by keydb"))
+
+			By("changing the engine of a running instance")
+			redis.Spec.Version = ""
+			redis.Spec.Config = nil
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+			Expect(redis.Spec.Version).Should(Equal("8.0.1"))
+			redis.Spec.Engine = EngineRedis
+			redis.Spec.Version = "7.2.4"
+			err = k8sClient.Update(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.engine: Forbidden"))
+			Expect(k8sClient.Delete(ctx, redis)).Should(Succeed())
+		})
+		It("should reject negative probe timings", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Probes: &ProbesSpec{
+						Startup:   &ProbeSpec{FailureThreshold: 720},
+						Readiness: &ProbeSpec{PeriodSeconds: -1},
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.probes.readiness.periodSeconds: Invalid value: -1"))
+			Expect(err.Error()).ShouldNot(ContainSubstring("spec.probes.startup"))
+		})
 		It("should set default values", func() {
 			By("creating a redis resource")
 			ctx := context.Background()
@@ -83,6 +411,165 @@ var _ = Describe("redis webhook", func() {
 			}, timeout, interval).Should(BeTrue())
 			Expect(createdRedis.Spec.LogLevel).Should(Equal(RLogLevelNotice))
 			Expect(createdRedis.Spec.ClusterSize).Should(Equal(1))
+			Expect(createdRedis.Spec.Mode).Should(Equal(ModeReplication))
+			Expect(createdRedis.Spec.Port).Should(Equal(6379))
+			Expect(createdRedis.Spec.Version).Should(Equal(DefaultVersion))
+			Expect(createdRedis.Spec.Databases).Should(Equal(DefaultDatabases))
+		})
+	})
+	Context("when updating a redis instance", func() {
+		It("should refuse downgrades to an older RDB format", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-downgrade",
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Version: "7.0.11",
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("downgrading within the same RDB format")
+			redis.Spec.Version = "7.0.5"
+			Expect(k8sClient.Update(ctx, redis)).Should(Succeed())
+
+			By("downgrading to an older RDB format")
+			redis.Spec.Version = "6.2.3"
+			Expect(k8sClient.Update(ctx, redis)).ShouldNot(Succeed())
+		})
+
+		It("should keep at least one replica when scaling down", func() {
+			By("creating a replicated redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-scale-down",
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					ClusterSize: 3,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("scaling down to a single replica")
+			redis.Spec.ClusterSize = 2
+			Expect(k8sClient.Update(ctx, redis)).Should(Succeed())
+
+			By("scaling down to a lone master")
+			redis.Spec.ClusterSize = 1
+			err := k8sClient.Update(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.clusterSize"))
+		})
+
+		It("should keep at least one replica when scaling through the scale subresource", func() {
+			By("creating a replicated redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-scale-subresource",
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					ClusterSize: 2,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("scaling up like kubectl scale")
+			scale := &autoscalingv1.Scale{
+				TypeMeta: metav1.TypeMeta{APIVersion: "autoscaling/v1", Kind: "Scale"},
+				Spec:     autoscalingv1.ScaleSpec{Replicas: 3},
+			}
+			Expect(k8sClient.SubResource("scale").Update(ctx, redis, client.WithSubResourceBody(scale))).Should(Succeed())
+
+			By("scaling down to a lone master like kubectl scale")
+			scale = &autoscalingv1.Scale{
+				TypeMeta: metav1.TypeMeta{APIVersion: "autoscaling/v1", Kind: "Scale"},
+				Spec:     autoscalingv1.ScaleSpec{Replicas: 1},
+			}
+			err := k8sClient.SubResource("scale").Update(ctx, redis, client.WithSubResourceBody(scale))
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("would remove the last replica"))
+		})
+
+		It("should refuse changing the mode", func() {
+			By("creating a standalone redis resource")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-mode-change",
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Mode:        ModeStandalone,
+					ClusterSize: 1,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("switching to replication")
+			redis.Spec.Mode = ModeReplication
+			redis.Spec.ClusterSize = 3
+			err := k8sClient.Update(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.mode: Forbidden"))
+		})
+
+		It("should refuse removing auth while clients are connected", func() {
+			By("creating a redis resource with auth")
+			ctx := context.Background()
+			redis := &Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-auth-removal",
+					Namespace: redisNamespace,
+				},
+				Spec: RedisSpec{
+					Auth: &AuthSpec{SecretName: "redis-auth"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("reporting a connected client")
+			redis.Status.ConnectedClients = 1
+			Expect(k8sClient.Status().Update(ctx, redis)).Should(Succeed())
+
+			By("removing auth")
+			redis.Spec.Auth = nil
+			err := k8sClient.Update(ctx, redis)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("spec.auth"))
+
+			By("removing auth once the clients disconnected")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: redis.Name, Namespace: redisNamespace}, redis)).Should(Succeed())
+			redis.Status.ConnectedClients = 0
+			Expect(k8sClient.Status().Update(ctx, redis)).Should(Succeed())
+			redis.Spec.Auth = nil
+			Expect(k8sClient.Update(ctx, redis)).Should(Succeed())
 		})
 	})
 })
@@ -0,0 +1,423 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// resource status enum
+type Status string
+
+const (
+	StatusPending Status = "Pending"
+	StatusFailed  Status = "Failed"
+	StatusSuccess Status = "Success"
+)
+
+// RedisMode is the topology a redis instance is deployed in
+// +kubebuilder:validation:Enum=standalone;replication
+type RedisMode string
+
+const (
+	// ModeStandalone runs a single redis instance without replicas
+	ModeStandalone RedisMode = "standalone"
+	// ModeReplication runs a master with replicas following it
+	ModeReplication RedisMode = "replication"
+)
+
+// RedisEngine is the redis compatible server an instance runs
+// +kubebuilder:validation:Enum=redis;valkey;keydb
+type RedisEngine string
+
+// redis log levels enum
+type RedisLogLevel string
+
+const (
+	RLogLevelDebug   RedisLogLevel = "debug"
+	RLogLevelVerbose RedisLogLevel = "verbose"
+	RLogLevelNotice  RedisLogLevel = "notice"
+	RLogLevelWarning RedisLogLevel = "warning"
+)
+
+// phases of a rolling upgrade
+type UpgradePhase string
+
+const (
+	UpgradePhaseReplicas UpgradePhase = "UpgradingReplicas"
+	UpgradePhaseFailover UpgradePhase = "FailingOver"
+	UpgradePhaseMaster   UpgradePhase = "UpgradingMaster"
+	UpgradePhaseFailback UpgradePhase = "FailingBack"
+)
+
+// UpgradeStatus tracks a rolling upgrade in progress
+type UpgradeStatus struct {
+	// From is the version running before the upgrade started
+	From string `json:"from"`
+	// To is the version being upgraded to
+	To string `json:"to"`
+	// Phase of the upgrade
+	Phase UpgradePhase `json:"phase"`
+}
+
+// ServiceSpec configures how a service is exposed
+type ServiceSpec struct {
+	// Type of the service, one of ClusterIP, NodePort or LoadBalancer.
+	// Defaults to ClusterIP
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Annotations added to the service, for example to configure a cloud
+	// load balancer
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ExternalTrafficPolicy of the service, only valid for the NodePort and
+	// LoadBalancer types
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicyType `json:"externalTrafficPolicy,omitempty"`
+}
+
+// MasterSpec configures the master instance used for writes
+type MasterSpec struct {
+	// Service configures the exposure of the master service
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// Resources of the redis container
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Persistence configures how the master persists the dataset
+	Persistence *RolePersistenceSpec `json:"persistence,omitempty"`
+
+	// Config directives merged over spec.config for the master
+	Config map[string]string `json:"config,omitempty"`
+
+	// NodeSelector the master pods are scheduled by
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the master pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity of the master pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+}
+
+// ReplicasSpec configures the replica instances used for reads
+type ReplicasSpec struct {
+	// Service configures the exposure of the load balanced replica service
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// Resources of the redis container
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Persistence configures how the replicas persist the dataset
+	Persistence *RolePersistenceSpec `json:"persistence,omitempty"`
+
+	// Config directives merged over spec.config for the replicas
+	Config map[string]string `json:"config,omitempty"`
+
+	// NodeSelector the replica pods are scheduled by
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the replica pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity of the replica pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+}
+
+// RolePersistenceSpec configures how a role persists the dataset
+type RolePersistenceSpec struct {
+	// AppendOnly enables the append only file
+	AppendOnly *bool `json:"appendOnly,omitempty"`
+
+	// Snapshots enables RDB snapshots, false disables them
+	Snapshots *bool `json:"snapshots,omitempty"`
+}
+
+// RestoreSource describes where the initial dataset of a redis instance is
+// downloaded from before the master starts
+type RestoreSource struct {
+	// URL of the dump.rdb file to restore, for example a pre-signed object
+	// storage URL
+	URL string `json:"url"`
+
+	// SHA256 is the optional hex encoded checksum the downloaded file needs to
+	// match before it is loaded
+	SHA256 string `json:"sha256,omitempty"`
+
+	// SecretName is an optional secret in the same namespace whose keys are
+	// exposed as environment variables to the restore container
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// PersistenceSpec configures the dataset of the redis instances
+type PersistenceSpec struct {
+	// RestoreFrom seeds the master with an existing dataset before it starts
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+}
+
+// ProbeSpec configures the timings of a probe of the redis container
+type ProbeSpec struct {
+	// InitialDelaySeconds before the probe runs the first time
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+
+	// PeriodSeconds between two runs of the probe
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds after which a run of the probe fails
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// FailureThreshold is the amount of failed runs in a row after which
+	// the probe fails
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// ProbesSpec configures the probes of the redis container
+type ProbesSpec struct {
+	// Startup probe passing once redis loaded the dataset
+	Startup *ProbeSpec `json:"startup,omitempty"`
+
+	// Liveness probe restarting redis once it stops answering
+	Liveness *ProbeSpec `json:"liveness,omitempty"`
+
+	// Readiness probe passing while redis answers and replicas are in sync
+	Readiness *ProbeSpec `json:"readiness,omitempty"`
+}
+
+// AuthSpec configures password authentication of the redis instances
+type AuthSpec struct {
+	// SecretName of a secret in the same namespace holding the password
+	SecretName string `json:"secretName"`
+
+	// SecretKey is the key of the password within the secret, defaults to
+	// password
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// MetricsSpec configures the prometheus exporter running next to every redis
+// instance
+type MetricsSpec struct {
+	// Enabled adds a redis_exporter sidecar serving metrics on port 9121
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Image of the exporter, defaults to the redis_exporter release the
+	// operator was built against
+	Image string `json:"image,omitempty"`
+}
+
+// CommandPolicySpec restricts the commands clients can run
+type CommandPolicySpec struct {
+	// Disabled commands clients are not allowed to run
+	Disabled []string `json:"disabled,omitempty"`
+
+	// Renamed commands, mapping the command to its new name
+	Renamed map[string]string `json:"renamed,omitempty"`
+}
+
+// NetworkPolicySpec restricts which pods can reach the redis instances
+type NetworkPolicySpec struct {
+	// Clients allowed to connect to the redis port
+	Clients []NetworkPolicyPeer `json:"clients,omitempty"`
+
+	// MetricsNamespace is the namespace allowed to scrape the metrics
+	// exporter
+	MetricsNamespace string `json:"metricsNamespace,omitempty"`
+}
+
+// NetworkPolicyPeer selects the pods allowed to connect
+type NetworkPolicyPeer struct {
+	// NamespaceSelector selects namespaces by their labels
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// PodSelector selects pods by their labels
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+}
+
+// BindingSpec configures the connection details published for applications
+type BindingSpec struct {
+	// ConfigMap additionally publishes the non sensitive connection details
+	// in a config map of the same name as the binding secret
+	ConfigMap bool `json:"configMap,omitempty"`
+}
+
+// ModuleName is a redis module of the module catalogue
+// +kubebuilder:validation:Enum=json;search;bloom;timeseries
+type ModuleName string
+
+// ModuleSpec configures a redis module loaded on startup
+type ModuleSpec struct {
+	// Name of the module in the module catalogue
+	Name ModuleName `json:"name"`
+
+	// Path of the module shared object, within the image when one is given
+	Path string `json:"path,omitempty"`
+
+	// Image holding a pre-built module
+	Image string `json:"image,omitempty"`
+
+	// Args passed to the module when it is loaded, one word per argument,
+	// e.g. ["ERROR_RATE", "0.01"]
+	Args []string `json:"args,omitempty"`
+}
+
+// RedisSpec defines the desired state of Redis
+type RedisSpec struct {
+	// Mode is the topology of the instance, standalone runs a single
+	// instance while replication adds replicas following the master.
+	// Defaults to replication and cannot be changed
+	Mode RedisMode `json:"mode,omitempty"`
+
+	// ClusterSize determines the amount of redis instances running
+	ClusterSize int `json:"clusterSize,omitempty"`
+
+	// LogLevel specifies the redis verbosity level, one of debug, verbose,
+	// notice or warning
+	LogLevel RedisLogLevel `json:"logLevel,omitempty"`
+
+	// Databases sets the number of databases
+	Databases int `json:"databases,omitempty"`
+
+	// Config sets additional redis config directives
+	Config map[string]string `json:"config,omitempty"`
+
+	// Modules loaded by every redis instance
+	Modules []ModuleSpec `json:"modules,omitempty"`
+
+	// Engine is the redis compatible server to run, one of redis, valkey or
+	// keydb. Defaults to redis
+	Engine RedisEngine `json:"engine,omitempty"`
+
+	// Version of the engine to run, for example 6.2.3
+	Version string `json:"version,omitempty"`
+
+	// Port redis listens on. Defaults to 6379
+	Port int `json:"port,omitempty"`
+
+	// Probes configures the timings of the startup, liveness and readiness
+	// probes
+	Probes *ProbesSpec `json:"probes,omitempty"`
+
+	// Paused stops the operator from changing any resource or redis instance
+	Paused bool `json:"paused,omitempty"`
+
+	// Master configures the master instance
+	Master MasterSpec `json:"master,omitempty"`
+
+	// Replicas configures the replica instances
+	Replicas ReplicasSpec `json:"replicas,omitempty"`
+
+	// Persistence configures the dataset
+	Persistence PersistenceSpec `json:"persistence,omitempty"`
+
+	// Auth enables password authentication for clients and replication
+	Auth *AuthSpec `json:"auth,omitempty"`
+
+	// Metrics configures the prometheus exporter
+	Metrics *MetricsSpec `json:"metrics,omitempty"`
+
+	// CommandPolicy disables or renames commands for clients
+	CommandPolicy *CommandPolicySpec `json:"commandPolicy,omitempty"`
+
+	// NetworkPolicy restricts the access to the redis pods
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// PodSecurityContext of the redis pods
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// ContainerSecurityContext of every container of the redis pods
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+
+	// PodTemplate is a partial pod template merged over the generated pod
+	// template of every role
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+
+	// Binding configures the connection secret published for applications
+	Binding BindingSpec `json:"binding,omitempty"`
+}
+
+// ModuleStatus is a module loaded by redis
+type ModuleStatus struct {
+	// Name the module reports
+	Name string `json:"name"`
+
+	// Version of the module
+	Version string `json:"version"`
+}
+
+// RedisStatus defines the observed state of Redis
+type RedisStatus struct {
+	// status of redis cluster
+	Status Status `json:"status,omitempty"`
+
+	// master pod name
+	Master string `json:"master,omitempty"`
+
+	// version of redis currently running
+	Version string `json:"version,omitempty"`
+
+	// rolling upgrade in progress
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+
+	// amount of redis instances that are ready
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// amount of clients connected to the master
+	ConnectedClients int32 `json:"connectedClients,omitempty"`
+
+	// label selector matching every pod of the redis cluster
+	Selector string `json:"selector,omitempty"`
+
+	// secret holding the connection details for applications
+	Binding *corev1.LocalObjectReference `json:"binding,omitempty"`
+
+	// modules loaded by the acting master
+	Modules []ModuleStatus `json:"modules,omitempty"`
+
+	// conditions describing the observed state of the redis cluster
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Redis is the Schema for the redis API
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.clusterSize,statuspath=.status.replicas,selectorpath=.status.selector
+type Redis struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisSpec   `json:"spec,omitempty"`
+	Status RedisStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RedisList contains a list of Redis
+type RedisList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Redis `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Redis{}, &RedisList{})
+}
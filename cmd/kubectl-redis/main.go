@@ -0,0 +1,291 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-redis is a kubectl plugin to inspect and operate the redis
+// instances managed by the operator, installed on the PATH it is invoked as
+// kubectl redis
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"golang.org/x/term"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	"github.com/spazzy757/simple-redis/internal/config"
+	"github.com/spazzy757/simple-redis/internal/plugin"
+)
+
+const usage = `Inspect and operate redis instances managed by simple-redis.
+
+Usage:
+  kubectl redis [-n namespace] <command> <name> [flags]
+
+Commands:
+  status <name>                 show the topology, replication lag and conditions
+  cli <name> [-- args...]       run the CLI of the engine in the acting master
+  failover <name> [--to pod]    hand the master role to an in sync replica
+  backup now <name> [-o file]   snapshot the acting master and download dump.rdb
+  pause <name>                  pause reconciliation
+  resume <name>                 resume reconciliation
+  config diff <name>            compare the spec with the running config
+  render -f <file> [--diff old] print the generated objects, no cluster needed
+
+Flags:
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+
+	utilruntime.Must(simplev1.AddToScheme(scheme))
+}
+
+// errDiffer is returned when a render differs from the previous one, the
+// plugin exits with status 1 like diff does
+var errDiffer = errors.New("render differs")
+
+func main() {
+	err := run(os.Args[1:])
+	if errors.Is(err, errDiffer) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run used to dispatch the command line to the plugin commands
+func run(args []string) error {
+	var kubeconfig, namespace, to, output, file, previous, configFile, operatorNamespace string
+	var timeout time.Duration
+	fs := flag.NewFlagSet("kubectl-redis", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	fs.StringVar(&namespace, "namespace", "", "Namespace of the redis instance, defaults to the namespace of the current context.")
+	fs.StringVar(&namespace, "n", "", "Shorthand for --namespace.")
+	fs.StringVar(&to, "to", "", "failover: pod to hand the master role to, an in sync replica by default.")
+	fs.DurationVar(&timeout, "timeout", 2*time.Minute, "failover, backup: how long to wait for the operation to finish, 0 returns right away on failover.")
+	fs.StringVar(&output, "o", "", "backup: file to write dump.rdb to, defaults to <name>-<time>.rdb, - writes to stdout.")
+	fs.StringVar(&file, "f", "", "render: Redis manifest to render, - reads from stdin.")
+	fs.StringVar(&previous, "diff", "", "render: previous render to diff against, exits with status 1 when it differs.")
+	fs.StringVar(&configFile, "config", "", "render: operator config file with the fleet wide defaults.")
+	fs.StringVar(&operatorNamespace, "operator-namespace", "simple-redis-system", "render: namespace the operator runs in.")
+
+	// flags may follow the positional arguments, everything after -- is
+	// passed on to the CLI
+	var passthrough []string
+	for i, a := range args {
+		if a == "--" {
+			args, passthrough = args[:i], args[i+1:]
+			break
+		}
+	}
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) == 1 && positional[0] == "render" {
+		if namespace == "" {
+			namespace = "default"
+		}
+		return render(file, previous, configFile, plugin.RenderOptions{
+			Namespace:         namespace,
+			OperatorNamespace: operatorNamespace,
+		})
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		return fmt.Errorf("expected a command and the name of a redis instance")
+	}
+
+	loading := clientcmd.NewDefaultClientConfigLoadingRules()
+	loading.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loading, &clientcmd.ConfigOverrides{})
+	if namespace == "" {
+		ns, _, err := clientConfig.Namespace()
+		if err != nil {
+			return err
+		}
+		namespace = ns
+	}
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	exec, err := plugin.NewExecutor(cfg)
+	if err != nil {
+		return err
+	}
+	p := &plugin.Plugin{
+		Client:    c,
+		Exec:      exec,
+		Namespace: namespace,
+		Streams:   plugin.Streams{Out: os.Stdout, ErrOut: os.Stderr},
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	switch cmd, name := positional[0], positional[1]; cmd {
+	case "status":
+		return p.Status(ctx, name)
+	case "cli":
+		return cli(ctx, p, name, passthrough)
+	case "failover":
+		return p.Failover(ctx, name, to, timeout)
+	case "pause":
+		return p.SetPaused(ctx, name, true)
+	case "resume":
+		return p.SetPaused(ctx, name, false)
+	case "backup":
+		if name != "now" || len(positional) < 3 {
+			return fmt.Errorf("usage: kubectl redis backup now <name>")
+		}
+		return backup(ctx, p, positional[2], output, timeout)
+	case "config":
+		if name != "diff" || len(positional) < 3 {
+			return fmt.Errorf("usage: kubectl redis config diff <name>")
+		}
+		return p.ConfigDiff(ctx, positional[2])
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// cli used to run the CLI of the engine, attaching the terminal when it is
+// interactive
+func cli(ctx context.Context, p *plugin.Plugin, name string, args []string) error {
+	p.Streams.In = os.Stdin
+	fd := int(os.Stdin.Fd())
+	if len(args) > 0 || !term.IsTerminal(fd) {
+		return p.CLI(ctx, name, args)
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	p.Streams.TTY = true
+	return p.CLI(ctx, name, args)
+}
+
+// backup used to write the snapshot to the output file, removing it again
+// when the backup failed
+func backup(ctx context.Context, p *plugin.Plugin, name, output string, timeout time.Duration) error {
+	if output == "-" {
+		return p.Backup(ctx, name, os.Stdout, timeout)
+	}
+	if output == "" {
+		output = fmt.Sprintf("%v-%v.rdb", name, time.Now().UTC().Format("20060102T150405Z"))
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = p.Backup(ctx, name, f, timeout)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %v\n", output)
+	return nil
+}
+
+// render used to render a manifest offline, printing a diff instead when a
+// previous render is given
+func render(file, previous, configFile string, opts plugin.RenderOptions) error {
+	if file == "" {
+		return fmt.Errorf("usage: kubectl redis render -f <file> [--diff <previous>]")
+	}
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	if configFile != "" {
+		contents, err := os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		config, err := config.Parse(contents)
+		if err != nil {
+			return fmt.Errorf("parsing %v: %w", configFile, err)
+		}
+		opts.Defaults = config.Defaults
+	}
+	if previous == "" {
+		return plugin.Render(in, os.Stdout, opts)
+	}
+	old, err := os.ReadFile(previous)
+	if err != nil {
+		return err
+	}
+	var current bytes.Buffer
+	if err := plugin.Render(in, &current, opts); err != nil {
+		return err
+	}
+	differ, err := plugin.Diff(os.Stdout, previous, old, current.Bytes())
+	if err != nil {
+		return err
+	}
+	if differ {
+		return errDiffer
+	}
+	return nil
+}
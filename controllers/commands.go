@@ -0,0 +1,97 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// adminPasswordBytes is the amount of random bytes in a generated admin
+// password
+const adminPasswordBytes = 32
+
+// reconcileAdminSecret used to create the secret holding the password of the
+// admin user once a command policy is set. The password is generated once and
+// never rotated by the operator
+func (r *RedisReconciler) reconcileAdminSecret(ctx context.Context, req ctrl.Request, sr simplev1.Redis) error {
+	if sr.Spec.CommandPolicy == nil {
+		return nil
+	}
+	var existing v1.Secret
+	lookup := client.ObjectKey{Name: iredis.AdminSecretName(sr.Name), Namespace: req.Namespace}
+	err := r.Get(ctx, lookup, &existing)
+	if err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+	buf := make([]byte, adminPasswordBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("generating admin password: %w", err)
+	}
+	secret := iredis.GenerateAdminSecret(sr.Name, req.Namespace, hex.EncodeToString(buf))
+	if err := controllerutil.SetControllerReference(&sr, secret, r.Scheme); err != nil {
+		return err
+	}
+	return r.Create(ctx, secret)
+}
+
+// credentials used to get the credentials the operator connects with, in order
+// of preference. With a command policy the admin user is preferred as clients
+// may have the management commands disabled, the client password is kept as
+// a fallback for pods still running without the admin user
+func (r *RedisReconciler) credentials(ctx context.Context, sr simplev1.Redis, password string) ([]iredis.Credentials, error) {
+	fallback := iredis.Credentials{Password: password}
+	if sr.Spec.CommandPolicy == nil {
+		return []iredis.Credentials{fallback}, nil
+	}
+	var secret v1.Secret
+	lookup := types.NamespacedName{Name: iredis.AdminSecretName(sr.Name), Namespace: sr.Namespace}
+	if err := r.Get(ctx, lookup, &secret); err != nil {
+		if errors.IsNotFound(err) {
+			return []iredis.Credentials{fallback}, nil
+		}
+		return []iredis.Credentials{fallback}, err
+	}
+	admin, err := iredis.AdminPassword(&secret)
+	if err != nil {
+		return []iredis.Credentials{fallback}, err
+	}
+	return []iredis.Credentials{{Username: iredis.AdminUser, Password: admin}, fallback}, nil
+}
+
+// commandPolicyArgs used to render the ACL users and renamed commands of the
+// command policy for a redis deployment
+func commandPolicyArgs(sr simplev1.Redis, version string) []string {
+	policy := sr.Spec.CommandPolicy
+	if policy == nil {
+		return nil
+	}
+	args := iredis.ACLArgs(policy.Disabled, sr.Spec.Auth != nil, simplev1.AtLeast(simplev1.CompatibleVersion(sr.Spec.Engine, version), "6.2"))
+	return append(args, iredis.RenameArgs(policy.Renamed)...)
+}
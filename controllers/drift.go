@@ -0,0 +1,111 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// drifted is an owned object that was changed out-of-band along with the
+// fields that no longer matched the spec
+type drifted struct {
+	kind   string
+	name   string
+	fields []string
+}
+
+func (d drifted) String() string {
+	return fmt.Sprintf("%v %v: %v", d.kind, d.name, strings.Join(d.fields, ", "))
+}
+
+// reconcileOwned used to create or update an object owned by the redis
+// instance. Objects are stamped with the hash of their desired state and only
+// written when it changed or when they were modified out-of-band, which is
+// reported as drift
+func (r *RedisReconciler) reconcileOwned(ctx context.Context, sr simplev1.Redis, obj client.Object) (*drifted, error) {
+	if err := controllerutil.SetControllerReference(&sr, obj, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := iredis.SetSpecHash(obj); err != nil {
+		return nil, err
+	}
+	existing := obj.DeepCopyObject().(client.Object)
+	err := r.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if errors.IsNotFound(err) {
+		return nil, r.Create(ctx, obj)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// objects of the same name managed by someone else are left alone
+	if owner := metav1.GetControllerOf(existing); owner != nil && owner.UID != sr.UID {
+		return nil, &controllerutil.AlreadyOwnedError{Object: existing, Owner: *owner}
+	}
+	// a changed hash means the spec changed, an unchanged hash with
+	// differing fields means someone else modified the object
+	hash := obj.GetAnnotations()[iredis.SpecHashAnnotation]
+	if existing.GetAnnotations()[iredis.SpecHashAnnotation] != hash {
+		return nil, r.Update(ctx, obj)
+	}
+	fields, err := iredis.Drift(obj, existing)
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+	d := &drifted{kind: fmt.Sprintf("%T", obj), name: obj.GetName(), fields: fields}
+	if gvk, err := apiutil.GVKForObject(obj, r.Scheme); err == nil {
+		d.kind = gvk.Kind
+	}
+	return d, r.Update(ctx, obj)
+}
+
+// reconcileDrifted used to report the Drifted condition and record an event
+// for every object restored during this reconcile
+func (r *RedisReconciler) reconcileDrifted(sr *simplev1.Redis, objects []drifted) {
+	cond := metav1.Condition{
+		Type:               simplev1.ConditionDrifted,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: sr.Generation,
+		Reason:             "InSync",
+		Message:            "the generated objects match the spec",
+	}
+	if len(objects) > 0 {
+		messages := make([]string, 0, len(objects))
+		for _, d := range objects {
+			messages = append(messages, d.String())
+			if r.Recorder != nil {
+				r.Recorder.Eventf(sr, v1.EventTypeWarning, "Drifted", "restored %v", d)
+			}
+		}
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "OutOfBandChange"
+		cond.Message = "restored objects modified outside of the operator: " + strings.Join(messages, "; ")
+	}
+	meta.SetStatusCondition(&sr.Status.Conditions, cond)
+}
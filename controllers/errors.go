@@ -0,0 +1,113 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+)
+
+// isPermanent used to check whether retrying cannot resolve an error: the
+// API server rejected a generated object or an object of the same name is
+// owned by someone else. Either needs the spec or the cluster to change first
+func isPermanent(err error) bool {
+	var owned *controllerutil.AlreadyOwnedError
+	return apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) || errors.As(err, &owned)
+}
+
+// classify used to split the errors collected during a reconcile into the
+// transient ones worth retrying with backoff and the permanent ones
+func classify(err error) (transient, permanent error) {
+	var errs []error
+	var merr *multierror.Error
+	if errors.As(err, &merr) {
+		errs = flatten(merr)
+	} else if err != nil {
+		errs = []error{err}
+	}
+	t := &multierror.Error{ErrorFormat: joinErrors}
+	p := &multierror.Error{ErrorFormat: joinErrors}
+	for _, err := range errs {
+		if isPermanent(err) {
+			p = multierror.Append(p, err)
+		} else {
+			t = multierror.Append(t, err)
+		}
+	}
+	return t.ErrorOrNil(), p.ErrorOrNil()
+}
+
+// joinErrors used to print collected errors on a single line, as they end up
+// in the condition message
+func joinErrors(errs []error) string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// flatten used to list the errors of nested multierrors, the reconcile steps
+// collect their own errors before they are collected by the reconcile
+func flatten(merr *multierror.Error) []error {
+	var errs []error
+	for _, err := range merr.Errors {
+		var nested *multierror.Error
+		if errors.As(err, &nested) {
+			errs = append(errs, flatten(nested)...)
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// reconcileErrors used to report the outcome of a reconcile through the
+// Reconciled condition, a paused reconcile does not apply the spec and
+// reports neither success nor failure
+func reconcileErrors(sr *simplev1.Redis, paused bool, transient, permanent error) {
+	cond := metav1.Condition{
+		Type:               simplev1.ConditionReconciled,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sr.Generation,
+		Reason:             "Succeeded",
+		Message:            "the redis instance matches the spec",
+	}
+	switch {
+	case permanent != nil:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "PermanentError"
+		cond.Message = "retrying does not help, change the spec or the conflicting objects: " + permanent.Error()
+	case transient != nil:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "TransientError"
+		cond.Message = "retrying with backoff: " + transient.Error()
+	case paused:
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = "Paused"
+		cond.Message = "reconciliation is paused, the spec is not applied"
+	}
+	meta.SetStatusCondition(&sr.Status.Conditions, cond)
+}
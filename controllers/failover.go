@@ -0,0 +1,114 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// reconcileFailover used to hand the master role to the pod named in the
+// failover annotation. Upgrades take precedence, the request is picked up
+// again once the upgrade finished. The annotation is removed once the pod is
+// the acting master, so later elections and upgrades are not pulled back
+func (r *RedisReconciler) reconcileFailover(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error {
+	name := sr.Annotations[simplev1.FailoverAnnotation]
+	if name == "" {
+		return r.reconcileFailback(ctx, sr, state, creds)
+	}
+	if name == sr.Status.Master {
+		return r.clearFailover(ctx, sr)
+	}
+	if sr.Status.Upgrade != nil {
+		return nil
+	}
+	target := state.pod(name)
+	if target == nil {
+		return nil
+	}
+	// with role overrides a replica acting as master would run with the
+	// settings of the replicas
+	if sr.Spec.RolesOverridden() && target.Labels[iredis.RoleLabel] != "master" {
+		log.FromContext(ctx).Info("refusing failover to replica with role overrides", "pod", target.Name)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(sr, v1.EventTypeWarning, "FailoverRefused", "%v runs with the overrides of the replicas", target.Name)
+		}
+		return r.clearFailover(ctx, sr)
+	}
+	if target.role() == "master" {
+		log.FromContext(ctx).Info("failed over on request", "pod", target.Name)
+		sr.Status.Master = target.Name
+		if r.Recorder != nil {
+			r.Recorder.Eventf(sr, v1.EventTypeNormal, "FailedOver", "master role handed to %v", target.Name)
+		}
+		return r.clearFailover(ctx, sr)
+	}
+	return r.failover(ctx, *sr, state, target, runningVersion(*sr), creds)
+}
+
+// reconcileFailback used to hand the master role back to the pod of the
+// master deployment once it is in sync, when an election moved it to a
+// replica of an instance with role overrides
+func (r *RedisReconciler) reconcileFailback(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error {
+	if !sr.Spec.RolesOverridden() || sr.Status.Upgrade != nil {
+		return nil
+	}
+	master := state.pod(sr.Status.Master)
+	if master == nil || master.Labels[iredis.RoleLabel] == "master" {
+		return nil
+	}
+	for i := range state.pods {
+		target := &state.pods[i]
+		if target.Labels[iredis.RoleLabel] != "master" {
+			continue
+		}
+		// a new pod of the master deployment starts as an empty master, the
+		// hand over only finished once FAILOVER turned the acting master
+		// into a replica
+		if target.role() == "master" && master.role() == "slave" {
+			log.FromContext(ctx).Info("failed back to master deployment", "pod", target.Name)
+			sr.Status.Master = target.Name
+			if r.Recorder != nil {
+				r.Recorder.Eventf(sr, v1.EventTypeNormal, "FailedBack", "master role handed back to %v", target.Name)
+			}
+			return nil
+		}
+		return r.failover(ctx, *sr, state, target, runningVersion(*sr), creds)
+	}
+	return nil
+}
+
+// clearFailover used to remove the handled failover annotation. A copy is
+// patched so the status gathered during this reconcile is not replaced by
+// the one the API server returns
+func (r *RedisReconciler) clearFailover(ctx context.Context, sr *simplev1.Redis) error {
+	obj := sr.DeepCopy()
+	patch := client.MergeFrom(obj.DeepCopy())
+	delete(obj.Annotations, simplev1.FailoverAnnotation)
+	if err := r.Patch(ctx, obj, patch); err != nil {
+		return err
+	}
+	sr.Annotations = obj.Annotations
+	sr.ResourceVersion = obj.ResourceVersion
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/go-multierror"
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=patch
+//+kubebuilder:rbac:groups="",resources=pods/status,verbs=patch
+
+// reconcileMaster used to make sure exactly one pod acts as master. The acting
+// master is recorded in status.master and labelled so the master service
+// follows it, every other pod replicates from it through the master service
+func (r *RedisReconciler) reconcileMaster(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error {
+	log := log.FromContext(ctx)
+	port := redisPort(*sr)
+	master := state.pod(sr.Status.Master)
+	if master == nil {
+		master = electMaster(state)
+		if master == nil {
+			return nil
+		}
+		log.Info("electing master", "pod", master.Name)
+		sr.Status.Master = master.Name
+	}
+
+	var errs error
+	// a replica elected after the acting master went away is promoted
+	if master.role() == "slave" {
+		if err := r.do(ctx, master.Pod, port, creds, "REPLICAOF", "NO", "ONE"); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("promoting %v: %w", master.Name, err))
+		}
+	}
+
+	// the master service only points at the acting master once the label was
+	// observed on it, until then replicas are not moved over to the service
+	svcReady := master.Labels[iredis.MasterLabel] == "true"
+	svcHost := iredis.ResourceName(sr.Name, "master")
+	for _, p := range state.pods {
+		if err := r.labelMaster(ctx, p.Pod, p.Name == master.Name); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		if p.Name == master.Name {
+			continue
+		}
+		// pods of the master deployment start as an empty master and pods
+		// that took part in a failover replicate from a pod address, both
+		// are pointed at the acting master through the master service
+		stray := p.role() == "master"
+		repoint := svcReady && p.role() == "slave" && p.info["master_host"] != svcHost
+		if !stray && !repoint {
+			continue
+		}
+		log.Info("replicating from master service", "pod", p.Name)
+		if err := r.do(ctx, p.Pod, port, creds, "REPLICAOF", svcHost, strconv.Itoa(port)); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("replicating %v: %w", p.Name, err))
+		}
+	}
+	return errs
+}
+
+// electMaster used to pick the pod to act as master when there is none. Only
+// pods holding the dataset qualify, the most advanced one wins and the master
+// deployment breaks ties. Pods of the master deployment start as an empty
+// master, one is only elected when every pod answers and none holds any data,
+// as on the first bootstrap, electing it otherwise would wipe the replicas
+func electMaster(state replicaState) *redisPod {
+	var elected, empty *redisPod
+	answered := true
+	for i := range state.pods {
+		p := &state.pods[i]
+		switch {
+		case p.info == nil:
+			answered = false
+		case p.holdsData():
+			if elected == nil || preferred(p, elected) {
+				elected = p
+			}
+		case p.Labels[iredis.RoleLabel] == "master" && p.role() == "master":
+			if empty == nil || p.Name < empty.Name {
+				empty = p
+			}
+		}
+	}
+	if elected == nil && answered {
+		return empty
+	}
+	return elected
+}
+
+// holdsData used to check whether a pod has the dataset: it is in sync, or
+// it replicated data before, e.g. a replica whose link broke with the loss of
+// the master or a promoted replica
+func (p redisPod) holdsData() bool {
+	return p.inSync() || (p.info["master_sync_in_progress"] != "1" && p.offset() > 0)
+}
+
+// offset used to get the replication offset a pod reports
+func (p redisPod) offset() int64 {
+	offset, _ := strconv.ParseInt(p.info["master_repl_offset"], 10, 64)
+	return offset
+}
+
+// preferred used to order the pods holding data: the larger replication
+// offset first, then the pods of the master deployment, then by name
+func preferred(a, b *redisPod) bool {
+	if a.offset() != b.offset() {
+		return a.offset() > b.offset()
+	}
+	aMaster := a.Labels[iredis.RoleLabel] == "master"
+	if bMaster := b.Labels[iredis.RoleLabel] == "master"; aMaster != bMaster {
+		return aMaster
+	}
+	return a.Name < b.Name
+}
+
+// labelMaster used to set or remove the master label on a pod
+func (r *RedisReconciler) labelMaster(ctx context.Context, pod v1.Pod, master bool) error {
+	if (pod.Labels[iredis.MasterLabel] == "true") == master {
+		return nil
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	if master {
+		pod.Labels[iredis.MasterLabel] = "true"
+	} else {
+		delete(pod.Labels, iredis.MasterLabel)
+	}
+	return r.Patch(ctx, &pod, patch)
+}
+
+// reconcileReadiness used to set the in sync readiness gate of every pod, the
+// acting master is in sync by definition while any other pod needs to report
+// an up link to its master with no sync in progress
+func (r *RedisReconciler) reconcileReadiness(ctx context.Context, sr simplev1.Redis, state replicaState) error {
+	var errs error
+	for _, p := range state.pods {
+		inSync := p.inSync() || (p.Name == sr.Status.Master && p.role() == "master")
+		if err := r.setInSync(ctx, p.Pod, inSync); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs
+}
+
+// setInSync used to update the in sync condition on the pod status
+func (r *RedisReconciler) setInSync(ctx context.Context, pod v1.Pod, inSync bool) error {
+	status := v1.ConditionFalse
+	if inSync {
+		status = v1.ConditionTrue
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == iredis.InSyncCondition && c.Status == status {
+			return nil
+		}
+	}
+	patch := client.StrategicMergeFrom(pod.DeepCopy())
+	cond := v1.PodCondition{
+		Type:               iredis.InSyncCondition,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+	}
+	found := false
+	for i, c := range pod.Status.Conditions {
+		if c.Type == iredis.InSyncCondition {
+			pod.Status.Conditions[i] = cond
+			found = true
+		}
+	}
+	if !found {
+		pod.Status.Conditions = append(pod.Status.Conditions, cond)
+	}
+	return r.Status().Patch(ctx, &pod, patch)
+}
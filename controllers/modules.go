@@ -0,0 +1,65 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// redisModules used to get the modules of the spec every redis instance
+// loads
+func redisModules(sr simplev1.Redis) []iredis.Module {
+	modules := make([]iredis.Module, 0, len(sr.Spec.Modules))
+	for _, m := range sr.Spec.Modules {
+		modules = append(modules, iredis.Module{
+			Name:  string(m.Name),
+			Path:  m.Path,
+			Image: m.Image,
+			Args:  m.Args,
+		})
+	}
+	return modules
+}
+
+// loadedModules used to list the modules the acting master loaded with
+// MODULE LIST
+func (r *RedisReconciler) loadedModules(ctx context.Context, sr simplev1.Redis, state replicaState, creds []iredis.Credentials) ([]simplev1.ModuleStatus, error) {
+	if len(sr.Spec.Modules) == 0 {
+		return nil, nil
+	}
+	master := state.pod(sr.Status.Master)
+	if master == nil || !containersReady(master.Pod) {
+		return sr.Status.Modules, nil
+	}
+	c, err := r.dial(ctx, master.Pod, redisPort(sr), creds)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	loaded, err := iredis.ModuleList(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	modules := make([]simplev1.ModuleStatus, 0, len(loaded))
+	for _, m := range loaded {
+		modules = append(modules, simplev1.ModuleStatus{Name: m.Name, Version: m.Version})
+	}
+	return modules, nil
+}
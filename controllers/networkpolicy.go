@@ -0,0 +1,85 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+// operatorPodLabels select the operator pods, they connect to every redis
+// instance to observe and steer replication
+var operatorPodLabels = map[string]string{"control-plane": "controller-manager"}
+
+// reconcileNetworkPolicies used to restrict the access to the redis pods to
+// the allowed clients, the pods of the instance, the operator and the metrics
+// namespace. The policies are removed when spec.networkPolicy is not set
+func (r *RedisReconciler) reconcileNetworkPolicies(ctx context.Context, req ctrl.Request, sr simplev1.Redis) ([]drifted, error) {
+	var apply, remove []client.Object
+	for _, p := range networkPolicies(sr, r.OperatorNamespace) {
+		if p.enabled {
+			apply = append(apply, p.policy)
+		} else {
+			remove = append(remove, p.policy)
+		}
+	}
+	return r.reconcileObjects(ctx, sr, apply, remove)
+}
+
+// networkPolicy is a generated network policy, disabled policies are removed
+type networkPolicy struct {
+	policy  *networkingv1.NetworkPolicy
+	enabled bool
+}
+
+// networkPolicies used to generate the clients, replication and metrics
+// policies of an instance
+func networkPolicies(sr simplev1.Redis, operatorNamespace string) []networkPolicy {
+	spec := sr.Spec.NetworkPolicy
+	port := redisPort(sr)
+
+	var clients []networkingv1.NetworkPolicyPeer
+	if spec != nil {
+		for _, peer := range spec.Clients {
+			clients = append(clients, networkingv1.NetworkPolicyPeer{
+				NamespaceSelector: peer.NamespaceSelector,
+				PodSelector:       peer.PodSelector,
+			})
+		}
+	}
+	if operatorNamespace != "" {
+		clients = append(clients, iredis.NamespacePeer(operatorNamespace, operatorPodLabels))
+	}
+	var scrapers []networkingv1.NetworkPolicyPeer
+	if spec != nil && spec.MetricsNamespace != "" {
+		scrapers = append(scrapers, iredis.NamespacePeer(spec.MetricsNamespace, nil))
+	}
+
+	return []networkPolicy{
+		{iredis.GenerateNetworkPolicy(sr.Name, sr.Namespace, "clients", port, clients), spec != nil},
+		{iredis.GenerateNetworkPolicy(sr.Name, sr.Namespace, "replication", port, iredis.ReplicationPeers(sr.Name)), spec != nil},
+		{iredis.GenerateNetworkPolicy(sr.Name, sr.Namespace, "metrics", iredis.ExporterPort, scrapers), len(scrapers) > 0},
+	}
+}
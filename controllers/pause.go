@@ -0,0 +1,64 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// isPaused used to check whether reconciliation is paused through the spec or
+// the annotation
+func isPaused(sr simplev1.Redis) bool {
+	return sr.Spec.Paused || sr.Annotations[simplev1.PausedAnnotation] == "true"
+}
+
+// reconcilePaused used to report the Paused condition and record an event
+// when reconciliation is paused or resumed
+func (r *RedisReconciler) reconcilePaused(sr *simplev1.Redis, paused bool) {
+	wasPaused := meta.IsStatusConditionTrue(sr.Status.Conditions, simplev1.ConditionPaused)
+	if paused == wasPaused && meta.FindStatusCondition(sr.Status.Conditions, simplev1.ConditionPaused) != nil {
+		return
+	}
+	cond := metav1.Condition{
+		Type:               simplev1.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: sr.Generation,
+		Reason:             "Reconciling",
+		Message:            "changes are applied to the redis instance",
+	}
+	if paused {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "Paused"
+		cond.Message = "reconciliation is paused, only the status is updated"
+	}
+	meta.SetStatusCondition(&sr.Status.Conditions, cond)
+
+	if r.Recorder == nil {
+		return
+	}
+	switch {
+	case paused && !wasPaused:
+		r.Recorder.Event(sr, v1.EventTypeNormal, "Paused", "reconciliation paused, resources are no longer changed")
+	case !paused && wasPaused:
+		r.Recorder.Event(sr, v1.EventTypeNormal, "Resumed", "reconciliation resumed")
+	}
+}
@@ -19,29 +19,60 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/go-multierror"
+	configv1alpha1 "github.com/spazzy757/simple-redis/api/config/v1alpha1"
 	simplev1 "github.com/spazzy757/simple-redis/api/v1"
 	iredis "github.com/spazzy757/simple-redis/internal/redis"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// DefaultResyncPeriod is how often settled instances are reconciled again
+// unless configured otherwise
+const DefaultResyncPeriod = time.Minute
+
 // RedisReconciler reconciles a Redis object
 type RedisReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Dial is used to connect to redis instances, defaults to iredis.Dial
+	Dial     iredis.Dialer
+	Recorder record.EventRecorder
+	// OperatorNamespace is the namespace the operator runs in, its pods are
+	// allowed through the network policies of every redis instance
+	OperatorNamespace string
+	// Defaults returns the fleet wide defaults of the operator config, none
+	// are applied when nil
+	Defaults func() configv1alpha1.RedisDefaults
+	// ResyncPeriod is how often a settled instance is reconciled again to
+	// pick up changes of the running redis instances, DefaultResyncPeriod
+	// when zero
+	ResyncPeriod time.Duration
+	// ExcludeNamespaces are namespaces whose instances are left to another
+	// operator, such as one deployed with the namespaced overlay
+	ExcludeNamespaces []string
 }
 
 //+kubebuilder:rbac:groups=simple.simple.redis,resources=redis,verbs=get;list;watch;create;update;patch;delete
@@ -51,6 +82,10 @@ type RedisReconciler struct {
 //+kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get
 //+kubebuilder:rbac:groups=v1,resources=service,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=v1,resources=service/status,verbs=get
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -73,46 +108,244 @@ func (r *RedisReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	}
 
 	var errors error
-	if err := r.reconcileMasterDeploy(ctx, req, sr); err != nil {
-		log.V(1).Error(err, "failed reconciling master deployment")
+	password, err := r.password(ctx, sr)
+	if err != nil {
+		log.V(1).Error(err, "failed reading auth secret")
+		errors = multierror.Append(errors, err)
+	}
+	creds, err := r.credentials(ctx, sr, password)
+	if err != nil {
+		log.V(1).Error(err, "failed reading admin secret")
 		errors = multierror.Append(errors, err)
 	}
 
-	if err := r.reconcileMasterSvc(ctx, req, sr); err != nil {
-		log.V(1).Error(err, "failed reconciling master service")
+	// the pods are observed before anything is changed, replicas are only
+	// added once the existing ones finished syncing from the master and the
+	// master role only moves between pods that are in sync
+	result := ctrl.Result{}
+	state, err := r.observe(ctx, sr, creds)
+	if err != nil {
+		log.V(1).Error(err, "failed observing pods")
 		errors = multierror.Append(errors, err)
 	}
 
-	if err := r.reconcileReplicaDeploy(ctx, req, sr); err != nil {
-		log.V(1).Error(err, "failed reconciling replica deployment")
+	// connected clients are reported so the webhook can refuse removing auth
+	// while they are still authenticating
+	if clients, err := r.connectedClients(ctx, sr, state, creds); err != nil {
+		log.V(1).Error(err, "failed counting connected clients")
 		errors = multierror.Append(errors, err)
+	} else {
+		sr.Status.ConnectedClients = clients
+	}
+
+	// modules are reported from the acting master, the last reported ones
+	// are kept while it is unavailable
+	if modules, err := r.loadedModules(ctx, sr, state, creds); err != nil {
+		log.V(1).Error(err, "failed listing loaded modules")
+		errors = multierror.Append(errors, err)
+	} else {
+		sr.Status.Modules = modules
+	}
+
+	// restore progress is only tracked until it succeeded once, ahead of the
+	// objects so the restore state tells later master pods to skip the
+	// download and sync from the acting master right away
+	restoring := false
+	if sr.Spec.RestoreFrom != nil && !meta.IsStatusConditionTrue(sr.Status.Conditions, simplev1.ConditionRestored) {
+		cond, err := r.restoreCondition(ctx, sr)
+		if err != nil {
+			log.V(1).Error(err, "failed checking restore progress")
+			errors = multierror.Append(errors, err)
+		} else {
+			meta.SetStatusCondition(&sr.Status.Conditions, cond)
+			restoring = cond.Status == metav1.ConditionUnknown
+		}
+	}
+
+	// while paused the operator keeps observing and reporting status but
+	// leaves every resource and redis instance untouched
+	paused := isPaused(sr)
+	r.reconcilePaused(&sr, paused)
+	if paused {
+		log.Info("reconciliation paused, skipping changes")
+		result.RequeueAfter = time.Second * 30
+	} else {
+		res, err := r.reconcileResources(ctx, req, &sr, state, password, creds)
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
+		result = res
+	}
+	if restoring {
+		result.RequeueAfter = time.Second * 10
 	}
 
-	// used to update redis status and handle various errors that could occur in
-	// isolation
+	sr.Status.Replicas = int32(state.synced)
+	if master := state.pod(sr.Status.Master); master != nil && podReady(master.Pod) {
+		sr.Status.Replicas++
+	}
+	sr.Status.Selector = labels.SelectorFromSet(iredis.InstanceLabels(sr.Name)).String()
 
+	// transient errors are returned so the request is retried with
+	// exponential backoff, permanent ones are reported and only retried on
+	// the resync as backing off cannot resolve them
+	transient, permanent := classify(errors)
+	reconcileErrors(&sr, paused, transient, permanent)
+	status := simplev1.StatusSuccess
 	if errors != nil {
-		if err := r.updateStatus(ctx, sr, simplev1.StatusFailed); err != nil {
+		status = simplev1.StatusFailed
+	}
+	if err := r.updateStatus(ctx, sr, status); err != nil {
+		transient = multierror.Append(transient, err)
+	}
+
+	switch {
+	case transient != nil:
+		log.Info("reconciliation failed, retrying", "error", transient.Error())
+		return ctrl.Result{}, transient
+	case permanent != nil:
+		log.Error(permanent, "reconciliation failed permanently, retrying on the resync")
+		return ctrl.Result{RequeueAfter: r.resyncPeriod()}, nil
+	}
+
+	// settled instances are resynced periodically, the runtime state of
+	// the redis pods can change without any event on the watched objects
+	if resync := r.resyncPeriod(); result.RequeueAfter == 0 || result.RequeueAfter > resync {
+		result.RequeueAfter = resync
+	}
+	log.Info("finished reconciliation")
+	return result, nil
+}
+
+// resyncPeriod used to get how often settled instances are reconciled again
+func (r *RedisReconciler) resyncPeriod() time.Duration {
+	if r.ResyncPeriod <= 0 {
+		return DefaultResyncPeriod
+	}
+	return r.ResyncPeriod
+}
+
+// reconcileResources used to drive the redis instance towards the spec: the
+// upgrade and master role are reconciled against the observed pods before the
+// deployments, services and binding are created or updated
+func (r *RedisReconciler) reconcileResources(ctx context.Context, req ctrl.Request, sr *simplev1.Redis, state replicaState, password string, creds []iredis.Credentials) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	result := ctrl.Result{}
+	var errors error
+	if err := r.reconcileAdminSecret(ctx, req, *sr); err != nil {
+		log.V(1).Error(err, "failed reconciling admin secret")
+		errors = multierror.Append(errors, err)
+	}
+
+	// the runtime actions and objects depend on the mode of the instance
+	topo := topologyFor(r, *sr)
+	v, err := topo.upgrade(ctx, sr, state, creds)
+	if err != nil {
+		log.V(1).Error(err, "failed upgrading")
+		errors = multierror.Append(errors, err)
+	}
+	if sr.Status.Upgrade != nil {
+		result.RequeueAfter = time.Second * 10
+	}
+
+	if err := topo.failover(ctx, sr, state, creds); err != nil {
+		log.V(1).Error(err, "failed reconciling requested failover")
+		errors = multierror.Append(errors, err)
+	}
+
+	if err := topo.bootstrap(ctx, sr, state, creds); err != nil {
+		log.V(1).Error(err, "failed reconciling master role")
+		errors = multierror.Append(errors, err)
+	}
+
+	if err := r.reconcileReadiness(ctx, *sr, state); err != nil {
+		log.V(1).Error(err, "failed reconciling readiness")
+		errors = multierror.Append(errors, err)
+	}
+
+	replicas, settled := topo.scale(*sr, state)
+	if !settled {
+		result.RequeueAfter = time.Second * 10
+	}
+
+	// generated objects changed out-of-band are restored and reported
+	var drift []drifted
+	apply, remove, err := topo.objects(*sr, v, replicas, r.defaults())
+	if err != nil {
+		log.V(1).Error(err, "failed generating deployments and services")
+		errors = multierror.Append(errors, err)
+	} else {
+		objects, err := r.reconcileObjects(ctx, *sr, apply, remove)
+		drift = append(drift, objects...)
+		if err != nil {
+			log.V(1).Error(err, "failed reconciling deployments and services")
 			errors = multierror.Append(errors, err)
 		}
 	}
 
-	if err := r.updateStatus(ctx, sr, simplev1.StatusSuccess); err != nil {
+	objects, err := r.reconcileNetworkPolicies(ctx, req, *sr)
+	drift = append(drift, objects...)
+	if err != nil {
+		log.V(1).Error(err, "failed reconciling network policies")
 		errors = multierror.Append(errors, err)
 	}
 
-	log.Info("finished reconciliation")
-	return ctrl.Result{}, nil
+	objects, err = r.reconcileRestoreState(ctx, *sr)
+	drift = append(drift, objects...)
+	if err != nil {
+		log.V(1).Error(err, "failed reconciling restore state")
+		errors = multierror.Append(errors, err)
+	}
+
+	objects, err = r.reconcileBinding(ctx, req, *sr, password)
+	drift = append(drift, objects...)
+	if err != nil {
+		log.V(1).Error(err, "failed reconciling binding")
+		errors = multierror.Append(errors, err)
+	} else {
+		sr.Status.Binding = &v1.LocalObjectReference{Name: iredis.BindingName(sr.Name)}
+	}
+	r.reconcileDrifted(sr, drift)
+
+	return result, errors
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. The generated
+// objects are watched so out-of-band changes are reverted right away, the
+// pods are owned by the replica sets of the deployments and are mapped to
+// their instance by label instead. Events of excluded namespaces are dropped
 func (r *RedisReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
+		WithEventFilter(predicate.NewPredicateFuncs(r.included)).
 		For(&simplev1.Redis{}).
-		Owns(&v1.Pod{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&v1.Service{}).
+		Owns(&v1.Secret{}).
+		Owns(&v1.ConfigMap{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Watches(&source.Kind{Type: &v1.Pod{}}, handler.EnqueueRequestsFromMapFunc(instanceOf)).
 		Complete(r)
 }
 
+// included used to filter out the objects of excluded namespaces
+func (r *RedisReconciler) included(obj client.Object) bool {
+	for _, ns := range r.ExcludeNamespaces {
+		if obj.GetNamespace() == ns {
+			return false
+		}
+	}
+	return true
+}
+
+// instanceOf used to map a pod to the redis instance it belongs to
+func instanceOf(obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[iredis.NameLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}}}
+}
+
 // updateStatus used to update the status of the Redis instance
 func (r *RedisReconciler) updateStatus(ctx context.Context, sr simplev1.Redis, status simplev1.Status) error {
 	sr.Status.Status = status
@@ -122,87 +355,557 @@ func (r *RedisReconciler) updateStatus(ctx context.Context, sr simplev1.Redis, s
 	return nil
 }
 
-// reconcileMasterDeploy used to reconcile the master redis instance deployment
-func (r *RedisReconciler) reconcileMasterDeploy(ctx context.Context, req ctrl.Request, sr simplev1.Redis) error {
+// masterDeployment used to generate the master deployment running the given
+// version
+func masterDeployment(sr simplev1.Redis, version string, defaults configv1alpha1.RedisDefaults) (*appsv1.Deployment, error) {
 	args := []string{
 		fmt.Sprintf("--loglevel %v", sr.Spec.LogLevel),
-		fmt.Sprintf("--databases %v", sr.Spec.Databases),
+		fmt.Sprintf("--databases %v", redisDatabases(sr)),
+		fmt.Sprintf("--port %v", redisPort(sr)),
 		"--bind 0.0.0.0",
 	}
+	args = append(args, configArgs(sr, sr.Spec.Master)...)
+	args = append(args, iredis.ModuleArgs(redisModules(sr))...)
+	if sr.Spec.Auth != nil {
+		args = append(args, fmt.Sprintf("--requirepass $(%v)", iredis.PasswordEnv))
+	}
+	args = append(args, commandPolicyArgs(sr, version)...)
 	// master has a single replica for now as multi master would be a future
 	// iteration
 	// TODO allow multi master setup
-	deploy := iredis.GenerateRedisDeploy(sr.Name, req.Namespace, "master", 1, args)
-	if err := controllerutil.SetControllerReference(&sr, deploy, r.Scheme); err != nil {
-		return err
+	deploy := iredis.GenerateRedisDeploy(sr.Name, sr.Namespace, "master", redisEngine(sr), redisImage(sr, defaults, version), 1, redisPort(sr), args)
+	applyDefaults(deploy, defaults, sr.Spec.Master)
+	iredis.AddModules(deploy, redisModules(sr))
+	// a new master pod syncs from the acting master before it is ready, so a
+	// rollout only removes the old master once the dataset was copied over
+	iredis.GateOnSync(deploy)
+	if auth := sr.Spec.Auth; auth != nil {
+		iredis.AddAuthEnv(deploy, auth.SecretName, auth.SecretKey)
 	}
-	u := &unstructured.Unstructured{}
-	u.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "apps",
-		Kind:    "Deployment",
-		Version: "v1",
-	})
-	lookup := types.NamespacedName{Name: deploy.Name, Namespace: deploy.Namespace}
-	err := r.Get(ctx, lookup, u)
-	if err != nil && errors.IsNotFound(err) {
-		err = r.Create(ctx, deploy)
-	} else if err == nil {
-		err = r.Update(ctx, deploy)
+	if sr.Spec.CommandPolicy != nil {
+		iredis.AddAdminEnv(deploy, sr.Name)
 	}
-	return err
+	if metrics := sr.Spec.Metrics; metrics != nil && metrics.Enabled {
+		iredis.AddExporterSidecar(deploy, exporterImage(sr, defaults), redisPort(sr))
+	}
+	// the init container stays after the restore so the template does not
+	// roll the restored pod, later pods skip it through the restore state
+	if src := sr.Spec.RestoreFrom; src != nil {
+		iredis.AddRestoreInitContainers(deploy, sr.Name, redisEngine(sr), iredis.Restore{
+			URL:        src.URL,
+			SHA256:     src.SHA256,
+			SecretName: src.SecretName,
+			Image:      defaults.RestoreImage,
+		})
+	}
+	return deploy, finishDeployment(sr, deploy)
 }
 
-// reconcileMasterSvc used to reconcile the master redis instance service
-func (r *RedisReconciler) reconcileMasterSvc(ctx context.Context, req ctrl.Request, sr simplev1.Redis) error {
-	svc := iredis.GenerateRedisSvc(sr.Name, req.Namespace, "master")
-	if err := controllerutil.SetControllerReference(&sr, svc, r.Scheme); err != nil {
-		return err
+// services used to generate the master, replica and headless services
+func services(sr simplev1.Redis) []*v1.Service {
+	master := iredis.GenerateRedisSvc(sr.Name, sr.Namespace, "master", redisPort(sr))
+	replica := iredis.GenerateRedisSvc(sr.Name, sr.Namespace, "replica", redisPort(sr))
+	if exp := sr.Spec.RoleService(sr.Spec.Master); exp != nil {
+		iredis.ExposeSvc(master, exp.Type, exp.Annotations, exp.ExternalTrafficPolicy)
 	}
-	u := &unstructured.Unstructured{}
-	u.SetGroupVersionKind(schema.GroupVersionKind{
-		Kind:    "Service",
-		Version: "v1",
-	})
-	lookup := types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}
-	err := r.Get(ctx, lookup, u)
-	if err != nil && errors.IsNotFound(err) {
-		err = r.Create(ctx, svc)
-	} else if err == nil {
-		err = r.Update(ctx, svc)
+	if exp := sr.Spec.RoleService(sr.Spec.Replicas); exp != nil {
+		iredis.ExposeSvc(replica, exp.Type, exp.Annotations, exp.ExternalTrafficPolicy)
 	}
-	return err
+	headless := iredis.GenerateHeadlessSvc(sr.Name, sr.Namespace, redisPort(sr))
+	return []*v1.Service{master, replica, headless}
+}
+
+// reconcileObjects used to create or update the objects of the topology and
+// remove the ones it does not use
+func (r *RedisReconciler) reconcileObjects(ctx context.Context, sr simplev1.Redis, apply, remove []client.Object) ([]drifted, error) {
+	var errs error
+	var objects []drifted
+	for _, obj := range apply {
+		d, err := r.reconcileOwned(ctx, sr, obj)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%T %v: %w", obj, obj.GetName(), err))
+		}
+		if d != nil {
+			objects = append(objects, *d)
+		}
+	}
+	for _, obj := range remove {
+		if err := client.IgnoreNotFound(r.Delete(ctx, obj)); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%T %v: %w", obj, obj.GetName(), err))
+		}
+	}
+	return objects, errs
+}
+
+// reconcileBinding used to publish the connection details for applications in
+// a secret and optionally a config map
+func (r *RedisReconciler) reconcileBinding(ctx context.Context, req ctrl.Request, sr simplev1.Redis, password string) ([]drifted, error) {
+	secret, cm := binding(sr, password)
+	apply := []client.Object{secret}
+	var remove []client.Object
+	if sr.Spec.Binding.ConfigMap {
+		apply = append(apply, cm)
+	} else {
+		remove = append(remove, cm)
+	}
+	return r.reconcileObjects(ctx, sr, apply, remove)
+}
+
+// reconcileRestoreState used to keep the restore state config map in line
+// with the Restored condition, it is removed without a restore source
+func (r *RedisReconciler) reconcileRestoreState(ctx context.Context, sr simplev1.Redis) ([]drifted, error) {
+	state := restoreState(sr)
+	if sr.Spec.RestoreFrom == nil {
+		return r.reconcileObjects(ctx, sr, nil, []client.Object{state})
+	}
+	return r.reconcileObjects(ctx, sr, []client.Object{state}, nil)
 }
 
-// reconcileReplicaDeploy used to reconcile the master redis instance deployment
-func (r *RedisReconciler) reconcileReplicaDeploy(ctx context.Context, req ctrl.Request, sr simplev1.Redis) error {
-	replicas := sr.Spec.ClusterSize - 1
-	// in the case that cluster size only has 1 or less instance
-	// we would set replicas to 0
-	if replicas < 0 {
-		replicas = 0
+// restoreState used to generate the restore state config map of an instance
+func restoreState(sr simplev1.Redis) *v1.ConfigMap {
+	restored := meta.IsStatusConditionTrue(sr.Status.Conditions, simplev1.ConditionRestored)
+	return iredis.GenerateRestoreState(sr.Name, sr.Namespace, restored)
+}
+
+// binding used to generate the binding secret and config map publishing the
+// connection details
+func binding(sr simplev1.Redis, password string) (*v1.Secret, *v1.ConfigMap) {
+	b := iredis.Binding{
+		Host:     iredis.MasterHost(sr.Name, sr.Namespace),
+		Port:     redisPort(sr),
+		Password: password,
+	}
+	return iredis.GenerateBindingSecret(sr.Name, sr.Namespace, b), iredis.GenerateBindingConfigMap(sr.Name, sr.Namespace, b)
+}
+
+// password used to read the redis password from the auth secret, an empty
+// password is returned when auth is disabled
+func (r *RedisReconciler) password(ctx context.Context, sr simplev1.Redis) (string, error) {
+	auth := sr.Spec.Auth
+	if auth == nil {
+		return "", nil
+	}
+	key := auth.SecretKey
+	if key == "" {
+		key = iredis.DefaultPasswordKey
 	}
+	var secret v1.Secret
+	lookup := types.NamespacedName{Name: auth.SecretName, Namespace: sr.Namespace}
+	if err := r.Get(ctx, lookup, &secret); err != nil {
+		return "", err
+	}
+	password, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("auth secret %v has no key %v", auth.SecretName, key)
+	}
+	return string(password), nil
+}
+
+// replicaDeployment used to generate the replica deployment running the given
+// version with the given amount of replicas
+func replicaDeployment(sr simplev1.Redis, version string, replicas int, defaults configv1alpha1.RedisDefaults) (*appsv1.Deployment, error) {
 	args := []string{
 		fmt.Sprintf("--loglevel %v", sr.Spec.LogLevel),
-		fmt.Sprintf("--databases %v", sr.Spec.Databases),
-		fmt.Sprintf("--replicaof %v-master 6392", sr.Name),
+		fmt.Sprintf("--databases %v", redisDatabases(sr)),
+		fmt.Sprintf("--port %v", redisPort(sr)),
+		fmt.Sprintf("--replicaof %v %v", iredis.ResourceName(sr.Name, "master"), redisPort(sr)),
 		"--bind 0.0.0.0",
 	}
-	deploy := iredis.GenerateRedisDeploy(sr.Name, req.Namespace, "replica", replicas, args)
-	if err := controllerutil.SetControllerReference(&sr, deploy, r.Scheme); err != nil {
-		return err
+	args = append(args, configArgs(sr, sr.Spec.Replicas)...)
+	args = append(args, iredis.ModuleArgs(redisModules(sr))...)
+	if sr.Spec.Auth != nil {
+		args = append(args, fmt.Sprintf("--requirepass $(%v)", iredis.PasswordEnv))
+		// with a command policy replicas sync as the admin user instead
+		if sr.Spec.CommandPolicy == nil {
+			args = append(args, fmt.Sprintf("--masterauth $(%v)", iredis.PasswordEnv))
+		}
+	}
+	args = append(args, commandPolicyArgs(sr, version)...)
+	deploy := iredis.GenerateRedisDeploy(sr.Name, sr.Namespace, "replica", redisEngine(sr), redisImage(sr, defaults, version), replicas, redisPort(sr), args)
+	applyDefaults(deploy, defaults, sr.Spec.Replicas)
+	iredis.AddModules(deploy, redisModules(sr))
+	iredis.GateOnSync(deploy)
+	iredis.OneAtATime(deploy)
+	if auth := sr.Spec.Auth; auth != nil {
+		iredis.AddAuthEnv(deploy, auth.SecretName, auth.SecretKey)
+	}
+	if sr.Spec.CommandPolicy != nil {
+		iredis.AddAdminEnv(deploy, sr.Name)
+	}
+	if metrics := sr.Spec.Metrics; metrics != nil && metrics.Enabled {
+		iredis.AddExporterSidecar(deploy, exporterImage(sr, defaults), redisPort(sr))
+	}
+	return deploy, finishDeployment(sr, deploy)
+}
+
+// finishDeployment used to merge the pod template of the spec over the
+// generated one, before the security context is set so sidecars are hardened
+// as well
+func finishDeployment(sr simplev1.Redis, deploy *appsv1.Deployment) error {
+	if probes := sr.Spec.Probes; probes != nil {
+		iredis.SetProbeTimings(deploy, iredis.ProbeStartup, probeTimings(probes.Startup))
+		iredis.SetProbeTimings(deploy, iredis.ProbeLiveness, probeTimings(probes.Liveness))
+		iredis.SetProbeTimings(deploy, iredis.ProbeReadiness, probeTimings(probes.Readiness))
 	}
-	u := &unstructured.Unstructured{}
-	u.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "apps",
-		Kind:    "Deployment",
-		Version: "v1",
-	})
-	lookup := types.NamespacedName{Name: deploy.Name, Namespace: deploy.Namespace}
-	err := r.Get(ctx, lookup, u)
-	if err != nil && errors.IsNotFound(err) {
-		err = r.Create(ctx, deploy)
-	} else if err == nil {
-		err = r.Update(ctx, deploy)
+	if err := iredis.MergePodTemplate(deploy, sr.Spec.PodTemplate); err != nil {
+		return fmt.Errorf("merging spec.podTemplate: %w", err)
 	}
+	iredis.SetSecurityContext(deploy, podSecurityContext(sr), containerSecurityContext(sr))
+	return nil
+}
+
+// probeTimings used to get the probe timings of the spec, nil keeps the
+// defaults
+func probeTimings(p *simplev1.ProbeSpec) iredis.ProbeTimings {
+	if p == nil {
+		return iredis.ProbeTimings{}
+	}
+	return iredis.ProbeTimings{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+}
+
+// replicaState is the observed state of the pods of a redis instance
+type replicaState struct {
+	// current is the replica count requested on the replica deployment
+	current int
+	// synced is the amount of replicas that finished syncing
+	synced int
+	// pods of the redis instance that are not terminating
+	pods []redisPod
+}
+
+// redisPod is a pod of the redis instance along with its INFO replication
+// fields, info is nil when the instance could not be queried
+type redisPod struct {
+	v1.Pod
+	info map[string]string
+}
+
+// pod used to look up an observed pod by name
+func (s replicaState) pod(name string) *redisPod {
+	for i := range s.pods {
+		if s.pods[i].Name == name {
+			return &s.pods[i]
+		}
+	}
+	return nil
+}
+
+// role used to get the replication role a pod reports, empty when unknown
+func (p redisPod) role() string {
+	return p.info["role"]
+}
+
+// inSync used to check whether a pod finished syncing from its master
+func (p redisPod) inSync() bool {
+	return p.info != nil && iredis.ReplicaInSync(p.info)
+}
+
+// observe used to query the replication state of every pod of the instance
+func (r *RedisReconciler) observe(ctx context.Context, sr simplev1.Redis, creds []iredis.Credentials) (replicaState, error) {
+	log := log.FromContext(ctx)
+	var state replicaState
+	var deploy appsv1.Deployment
+	lookup := types.NamespacedName{Name: iredis.ResourceName(sr.Name, "replica"), Namespace: sr.Namespace}
+	if err := r.Get(ctx, lookup, &deploy); err == nil && deploy.Spec.Replicas != nil {
+		state.current = int(*deploy.Spec.Replicas)
+	} else if err != nil && !errors.IsNotFound(err) {
+		return state, err
+	}
+
+	var pods v1.PodList
+	if err := r.List(ctx, &pods,
+		client.InNamespace(sr.Namespace),
+		client.MatchingLabels(iredis.InstanceLabels(sr.Name)),
+	); err != nil {
+		return state, err
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		p := redisPod{Pod: pod}
+		// replicas turn unready while their link to the master is down, they
+		// still have to be queried to elect a new master
+		if redisStarted(pod) {
+			info, err := r.info(ctx, pod, redisPort(sr), creds, "replication")
+			if err != nil {
+				log.V(1).Info("unable to query pod", "pod", pod.Name, "error", err.Error())
+			}
+			p.info = info
+		}
+		if pod.Labels[iredis.RoleLabel] == "replica" && p.inSync() {
+			state.synced++
+		}
+		state.pods = append(state.pods, p)
+	}
+	return state, nil
+}
+
+// connectedClients used to count the clients connected to the master, the
+// connection of the operator itself is not counted
+func (r *RedisReconciler) connectedClients(ctx context.Context, sr simplev1.Redis, state replicaState, creds []iredis.Credentials) (int32, error) {
+	master := state.pod(sr.Status.Master)
+	if master == nil || !containersReady(master.Pod) {
+		return 0, nil
+	}
+	info, err := r.info(ctx, master.Pod, redisPort(sr), creds, "clients")
+	if err != nil {
+		return 0, err
+	}
+	clients, err := strconv.Atoi(info["connected_clients"])
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse connected_clients: %w", err)
+	}
+	if clients > 0 {
+		clients--
+	}
+	return int32(clients), nil
+}
+
+// nextReplicas used to work out the replica count to request. Scaling down
+// happens at once, scaling up adds a single replica at a time once every
+// requested replica is in sync
+func nextReplicas(desired int, state replicaState) int {
+	if desired < 0 {
+		desired = 0
+	}
+	if desired <= state.current {
+		return desired
+	}
+	if state.synced < state.current {
+		return state.current
+	}
+	return state.current + 1
+}
+
+// info used to run INFO against a single redis pod
+func (r *RedisReconciler) info(ctx context.Context, pod v1.Pod, port int, creds []iredis.Credentials, section string) (map[string]string, error) {
+	c, err := r.dial(ctx, pod, port, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return iredis.Info(ctx, c, section)
+}
+
+// do used to run a single command against a redis pod
+func (r *RedisReconciler) do(ctx context.Context, pod v1.Pod, port int, creds []iredis.Credentials, args ...string) error {
+	c, err := r.dial(ctx, pod, port, creds)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.Do(ctx, args...)
 	return err
 }
+
+// dial used to connect to a redis pod, the credentials are tried in order so
+// pods that were not rolled out with the admin user yet stay reachable
+func (r *RedisReconciler) dial(ctx context.Context, pod v1.Pod, port int, creds []iredis.Credentials) (iredis.Client, error) {
+	dial := r.Dial
+	if dial == nil {
+		dial = iredis.Dial
+	}
+	addr := net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port))
+	if len(creds) == 0 {
+		return dial(ctx, addr, iredis.Credentials{})
+	}
+	var err error
+	for _, c := range creds {
+		var cl iredis.Client
+		if cl, err = dial(ctx, addr, c); err == nil {
+			return cl, nil
+		}
+	}
+	return nil, err
+}
+
+// redisPort used to get the port redis listens on, falling back to the
+// default when the spec was not defaulted by the webhook
+func redisPort(sr simplev1.Redis) int {
+	if sr.Spec.Port == 0 {
+		return iredis.DefaultPort
+	}
+	return sr.Spec.Port
+}
+
+// defaults used to get the fleet wide defaults of the operator config
+func (r *RedisReconciler) defaults() configv1alpha1.RedisDefaults {
+	if r.Defaults == nil {
+		return configv1alpha1.RedisDefaults{}
+	}
+	return r.Defaults()
+}
+
+// applyDefaults used to apply the resources and affinity of the operator
+// config to a redis deployment, replaced by the ones the role sets
+func applyDefaults(deploy *appsv1.Deployment, defaults configv1alpha1.RedisDefaults, role simplev1.RoleSpec) {
+	podSpec := &deploy.Spec.Template.Spec
+	podSpec.Containers[0].Resources = defaults.Resources
+	if role.Resources != nil {
+		podSpec.Containers[0].Resources = *role.Resources
+	}
+	podSpec.Affinity = defaults.Affinity
+	if role.Affinity != nil {
+		podSpec.Affinity = role.Affinity
+	}
+	podSpec.NodeSelector = role.NodeSelector
+	podSpec.Tolerations = role.Tolerations
+}
+
+// redisEngine used to get the engine an instance runs
+func redisEngine(sr simplev1.Redis) iredis.Engine {
+	return iredis.EngineFor(string(sr.Spec.Engine))
+}
+
+// redisImage used to get the image of a version of the engine, the image
+// repository of the operator config only applies to redis
+func redisImage(sr simplev1.Redis, defaults configv1alpha1.RedisDefaults, version string) string {
+	engine := redisEngine(sr)
+	if engine != iredis.RedisEngine {
+		return engine.Image("", version)
+	}
+	return engine.Image(defaults.Image, version)
+}
+
+// exporterImage used to get the metrics exporter image, the spec takes
+// precedence over the operator config
+func exporterImage(sr simplev1.Redis, defaults configv1alpha1.RedisDefaults) string {
+	if sr.Spec.Metrics != nil && sr.Spec.Metrics.Image != "" {
+		return sr.Spec.Metrics.Image
+	}
+	return defaults.ExporterImage
+}
+
+// podSecurityContext used to get the security context of the redis pods, the
+// spec replaces the hardened default
+func podSecurityContext(sr simplev1.Redis) *v1.PodSecurityContext {
+	if sr.Spec.PodSecurityContext != nil {
+		return sr.Spec.PodSecurityContext
+	}
+	return iredis.DefaultPodSecurityContext()
+}
+
+// containerSecurityContext used to get the security context of the redis
+// containers, the spec replaces the hardened default
+func containerSecurityContext(sr simplev1.Redis) *v1.SecurityContext {
+	if sr.Spec.ContainerSecurityContext != nil {
+		return sr.Spec.ContainerSecurityContext
+	}
+	return iredis.DefaultContainerSecurityContext()
+}
+
+// redisDatabases used to get the number of databases, falling back to the
+// redis default when the spec was not defaulted by the webhook
+func redisDatabases(sr simplev1.Redis) int {
+	if sr.Spec.Databases == 0 {
+		return simplev1.DefaultDatabases
+	}
+	return sr.Spec.Databases
+}
+
+// configArgs used to render the config directives of a role as arguments,
+// sorted so the generated deployment does not change between reconciles
+func configArgs(sr simplev1.Redis, role simplev1.RoleSpec) []string {
+	config := sr.Spec.RoleConfig(role)
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := make([]string, 0, len(names))
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("--%v %v", name, config[name]))
+	}
+	return args
+}
+
+// podReady used to check the ready condition of a pod
+func podReady(pod v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// containersReady used to check that the containers of a pod are ready, which
+// unlike the pod ready condition does not wait on readiness gates
+func containersReady(pod v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.ContainersReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// redisStarted used to check that the redis container of a pod passed its
+// startup probe and is running, which unlike readiness does not depend on
+// the link to the master
+func redisStarted(pod v1.Pod) bool {
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.Name == "redis" {
+			return c.Started != nil && *c.Started && c.State.Running != nil
+		}
+	}
+	return false
+}
+
+// restoreCondition used to derive the Restored condition from the restore init
+// container of the master pod
+func (r *RedisReconciler) restoreCondition(ctx context.Context, sr simplev1.Redis) (metav1.Condition, error) {
+	cond := metav1.Condition{
+		Type:               simplev1.ConditionRestored,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: sr.Generation,
+		Reason:             "Restoring",
+		Message:            "waiting for the master pod to start the restore",
+	}
+	var pods v1.PodList
+	if err := r.List(ctx, &pods,
+		client.InNamespace(sr.Namespace),
+		client.MatchingLabels(iredis.SelectorLabels(sr.Name, "master")),
+	); err != nil {
+		return cond, err
+	}
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.InitContainerStatuses {
+			var step string
+			switch cs.Name {
+			case iredis.RestoreDownloadContainerName:
+				step = "download"
+			case iredis.RestoreContainerName:
+				step = "restore"
+			default:
+				continue
+			}
+			switch {
+			case cs.Name == iredis.RestoreContainerName && cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0:
+				cond.Status = metav1.ConditionTrue
+				cond.Reason = "RestoreSucceeded"
+				cond.Message = fmt.Sprintf("dataset restored on pod %v", pod.Name)
+				return cond, nil
+			case cs.State.Terminated != nil && cs.State.Terminated.ExitCode != 0:
+				cond.Status = metav1.ConditionFalse
+				cond.Reason = "RestoreFailed"
+				cond.Message = fmt.Sprintf("%v on pod %v failed: %v", step, pod.Name, cs.State.Terminated.Message)
+			case cs.State.Terminated == nil && cs.LastTerminationState.Terminated != nil && cs.LastTerminationState.Terminated.ExitCode != 0:
+				cond.Status = metav1.ConditionFalse
+				cond.Reason = "RestoreFailed"
+				cond.Message = fmt.Sprintf("%v on pod %v failed, retrying: %v", step, pod.Name, cs.LastTerminationState.Terminated.Message)
+			case cs.State.Running != nil && cs.Name == iredis.RestoreDownloadContainerName:
+				cond.Message = fmt.Sprintf("downloading dump on pod %v", pod.Name)
+			case cs.State.Running != nil:
+				cond.Message = fmt.Sprintf("verifying dump on pod %v", pod.Name)
+			}
+		}
+	}
+	return cond, nil
+}
@@ -2,15 +2,131 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	configv1alpha1 "github.com/spazzy757/simple-redis/api/config/v1alpha1"
 	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// faultyClient fails the writes of the objects fails returns an error for,
+// injecting API server failures into a reconcile
+type faultyClient struct {
+	client.Client
+	fails func(obj client.Object) error
+}
+
+func (c faultyClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.fails(obj); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c faultyClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.fails(obj); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+// fakeRedis records the commands sent to the redis pods by address, replying
+// with the reply set for the command or OK
+type fakeRedis struct {
+	commands map[string][]string
+	replies  map[string]interface{}
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{commands: map[string][]string{}, replies: map[string]interface{}{}}
+}
+
+func (f *fakeRedis) dial(ctx context.Context, addr string, creds iredis.Credentials) (iredis.Client, error) {
+	return fakeConn{f: f, addr: addr}, nil
+}
+
+// sent used to list the commands sent to a pod IP, joined by spaces
+func (f *fakeRedis) sent(ip string) []string {
+	return f.commands[net.JoinHostPort(ip, strconv.Itoa(iredis.DefaultPort))]
+}
+
+type fakeConn struct {
+	f    *fakeRedis
+	addr string
+}
+
+func (c fakeConn) Do(ctx context.Context, args ...string) (interface{}, error) {
+	command := strings.Join(args, " ")
+	c.f.commands[c.addr] = append(c.f.commands[c.addr], command)
+	if reply, ok := c.f.replies[command]; ok {
+		if err, ok := reply.(error); ok {
+			return nil, err
+		}
+		return reply, nil
+	}
+	return "OK", nil
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+// fakeReconciler used to build a reconciler on top of the fake client and
+// fake redis pods, for the runtime actions that need no API server
+func fakeReconciler(f *fakeRedis, objs ...client.Object) *RedisReconciler {
+	s := runtime.NewScheme()
+	Expect(scheme.AddToScheme(s)).To(Succeed())
+	Expect(simplev1.AddToScheme(s)).To(Succeed())
+	return &RedisReconciler{
+		Client: fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+		Scheme: s,
+		Dial:   f.dial,
+	}
+}
+
+// fakePod used to build an observed pod of the given deployment role
+// reporting the given INFO replication fields
+func fakePod(name, role, ip, image string, info map[string]string) redisPod {
+	return redisPod{
+		Pod: v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{iredis.RoleLabel: role},
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "redis", Image: image}},
+			},
+			Status: v1.PodStatus{PodIP: ip},
+		},
+		info: info,
+	}
+}
+
+var (
+	masterInfo = map[string]string{"role": "master"}
+	syncedInfo = map[string]string{"role": "slave", "master_link_status": "up", "master_sync_in_progress": "0"}
 )
 
 var _ = Describe("redis controller", func() {
@@ -27,6 +143,390 @@ var _ = Describe("redis controller", func() {
 		interval = time.Millisecond * 250
 	)
 
+	Context("when dispatching on the mode", func() {
+
+		It("should run a master and replicas in replication mode", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{Name: "redis-topology", Namespace: redisNamespace},
+				Spec:       simplev1.RedisSpec{Mode: simplev1.ModeReplication, ClusterSize: 3},
+			}
+			state := replicaState{current: 1, synced: 1, pods: []redisPod{
+				fakePod("master-a", "master", "10.0.0.1", "redis:7.0.11-alpine", masterInfo),
+				fakePod("replica-a", "replica", "10.0.0.2", "redis:7.0.11-alpine", masterInfo),
+			}}
+			f := newFakeRedis()
+			r := fakeReconciler(f, sr, &state.pods[0].Pod, &state.pods[1].Pod)
+			topo := topologyFor(r, *sr)
+			Expect(topo).Should(BeAssignableToTypeOf(replication{}))
+
+			By("adding one replica at a time")
+			replicas, settled := topo.scale(*sr, state)
+			Expect(replicas).Should(Equal(2))
+			Expect(settled).Should(BeTrue())
+
+			By("generating both deployments and services")
+			apply, remove, err := topo.objects(*sr, versions{master: "7.0.11", replica: "7.0.11"}, replicas, r.defaults())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remove).Should(BeEmpty())
+			var names []string
+			for _, obj := range apply {
+				names = append(names, obj.GetName())
+			}
+			Expect(names).Should(ContainElements("redis-topology-master", "redis-topology-replica"))
+
+			By("electing the master and pointing the stray master at it")
+			Expect(topo.bootstrap(ctx, sr, state, nil)).Should(Succeed())
+			Expect(sr.Status.Master).Should(Equal("master-a"))
+			Expect(f.sent("10.0.0.1")).Should(BeEmpty())
+			Expect(f.sent("10.0.0.2")).Should(Equal([]string{"REPLICAOF redis-topology-master 6379"}))
+			pod := &v1.Pod{}
+			Expect(r.Get(ctx, client.ObjectKey{Name: "master-a", Namespace: "default"}, pod)).Should(Succeed())
+			Expect(pod.Labels).Should(HaveKeyWithValue(iredis.MasterLabel, "true"))
+		})
+
+		It("should run the master deployment only in standalone mode", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "redis-topology",
+					Namespace:   redisNamespace,
+					Annotations: map[string]string{simplev1.FailoverAnnotation: "master-b"},
+				},
+				Spec:   simplev1.RedisSpec{Mode: simplev1.ModeStandalone, ClusterSize: 1},
+				Status: simplev1.RedisStatus{Master: "master-a"},
+			}
+			state := replicaState{pods: []redisPod{
+				fakePod("master-a", "master", "10.0.0.1", "redis:7.0.11-alpine", masterInfo),
+			}}
+			f := newFakeRedis()
+			r := fakeReconciler(f, sr, &state.pods[0].Pod)
+			topo := topologyFor(r, *sr)
+			Expect(topo).Should(BeAssignableToTypeOf(standalone{}))
+
+			By("never adding replicas")
+			replicas, settled := topo.scale(*sr, state)
+			Expect(replicas).Should(BeZero())
+			Expect(settled).Should(BeTrue())
+
+			By("removing the objects of the replicas")
+			apply, remove, err := topo.objects(*sr, versions{master: "7.0.11", replica: "7.0.11"}, replicas, r.defaults())
+			Expect(err).NotTo(HaveOccurred())
+			for _, obj := range apply {
+				Expect(obj.GetName()).ShouldNot(Equal("redis-topology-replica"))
+			}
+			Expect(remove).Should(HaveLen(2))
+			for _, obj := range remove {
+				Expect(obj.GetName()).Should(Equal("redis-topology-replica"))
+			}
+
+			By("ignoring failover requests")
+			Expect(topo.failover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(topo.bootstrap(ctx, sr, state, nil)).Should(Succeed())
+			Expect(sr.Status.Master).Should(Equal("master-a"))
+			Expect(f.sent("10.0.0.1")).Should(BeEmpty())
+		})
+	})
+
+	Context("when restoring from a dump", func() {
+
+		It("should keep the master template once the instance was seeded", func() {
+			sr := simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{Name: "redis-restore", Namespace: redisNamespace},
+				Spec: simplev1.RedisSpec{
+					ClusterSize: 3,
+					RestoreFrom: &simplev1.RestoreSource{URL: "https://backups.example.com/dump.rdb"},
+				},
+			}
+			before, err := masterDeployment(sr, "7.0.11", configv1alpha1.RedisDefaults{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(iredis.SetSpecHash(before)).To(Succeed())
+			Expect(before.Spec.Template.Spec.InitContainers).Should(ContainElement(
+				HaveField("Name", iredis.RestoreContainerName),
+			))
+			Expect(restoreState(sr).Data).ShouldNot(HaveKey("restored"))
+
+			meta.SetStatusCondition(&sr.Status.Conditions, metav1.Condition{
+				Type:   simplev1.ConditionRestored,
+				Status: metav1.ConditionTrue,
+				Reason: "RestoreSucceeded",
+			})
+			after, err := masterDeployment(sr, "7.0.11", configv1alpha1.RedisDefaults{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(iredis.SetSpecHash(after)).To(Succeed())
+			Expect(after.Annotations[iredis.SpecHashAnnotation]).Should(Equal(before.Annotations[iredis.SpecHashAnnotation]))
+			Expect(after.Spec.Template).Should(Equal(before.Spec.Template))
+			Expect(restoreState(sr).Data).Should(HaveKeyWithValue("restored", "true"))
+		})
+
+		It("should report a failed download of the dump", func() {
+			ctx := context.Background()
+			sr := simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{Name: "redis-restore", Namespace: redisNamespace},
+				Spec: simplev1.RedisSpec{
+					RestoreFrom: &simplev1.RestoreSource{URL: "https://backups.example.com/dump.rdb"},
+				},
+			}
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-restore-master-0",
+					Namespace: redisNamespace,
+					Labels:    iredis.SelectorLabels(sr.Name, "master"),
+				},
+				Status: v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{
+					{
+						Name:  iredis.RestoreDownloadContainerName,
+						State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+						LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+							ExitCode: 22,
+							Message:  "curl: (22) The requested URL returned error: 404",
+						}},
+					},
+					{
+						Name:  iredis.RestoreContainerName,
+						State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "PodInitializing"}},
+					},
+				}},
+			}
+			r := fakeReconciler(newFakeRedis(), pod)
+			cond, err := r.restoreCondition(ctx, sr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cond.Status).Should(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).Should(Equal("RestoreFailed"))
+			Expect(cond.Message).Should(ContainSubstring("download on pod redis-restore-master-0 failed"))
+			Expect(cond.Message).Should(ContainSubstring("404"))
+
+			By("verifying the dump once it was downloaded")
+			pod.Status.InitContainerStatuses[0] = v1.ContainerStatus{
+				Name:                 iredis.RestoreDownloadContainerName,
+				State:                v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 22}},
+			}
+			pod.Status.InitContainerStatuses[1].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+			r = fakeReconciler(newFakeRedis(), pod)
+			cond, err = r.restoreCondition(ctx, sr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cond.Status).Should(Equal(metav1.ConditionUnknown))
+			Expect(cond.Message).Should(Equal("verifying dump on pod redis-restore-master-0"))
+		})
+	})
+
+	Context("when upgrading", func() {
+
+		It("should upgrade the replicas first and hand the master role back", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{Name: "redis-upgrade", Namespace: redisNamespace},
+				Spec:       simplev1.RedisSpec{Version: "7.2.4", ClusterSize: 2},
+				Status:     simplev1.RedisStatus{Master: "master-a", Version: "7.0.11"},
+			}
+			f := newFakeRedis()
+			r := fakeReconciler(f, sr)
+			state := replicaState{current: 1, pods: []redisPod{
+				fakePod("master-a", "master", "10.0.0.1", "redis:7.0.11-alpine", masterInfo),
+				fakePod("replica-a", "replica", "10.0.0.2", "redis:7.0.11-alpine", syncedInfo),
+			}}
+
+			By("upgrading the replicas")
+			master, replica, err := r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect([]string{master, replica}).Should(Equal([]string{"7.0.11", "7.2.4"}))
+			Expect(sr.Status.Upgrade.Phase).Should(Equal(simplev1.UpgradePhaseReplicas))
+
+			state.pods[1].Spec.Containers[0].Image = "redis:7.2.4-alpine"
+			_, _, err = r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sr.Status.Upgrade.Phase).Should(Equal(simplev1.UpgradePhaseFailover))
+
+			By("failing over to the upgraded replica")
+			_, _, err = r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.sent("10.0.0.1")).Should(Equal([]string{"FAILOVER TO 10.0.0.2 6379 TIMEOUT " + failoverTimeout}))
+
+			state.pods[0].info = syncedInfo
+			state.pods[1].info = masterInfo
+			master, replica, err = r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect([]string{master, replica}).Should(Equal([]string{"7.2.4", "7.2.4"}))
+			Expect(sr.Status.Master).Should(Equal("replica-a"))
+			Expect(sr.Status.Upgrade.Phase).Should(Equal(simplev1.UpgradePhaseMaster))
+
+			By("upgrading the master deployment")
+			state.pods[0].Spec.Containers[0].Image = "redis:7.2.4-alpine"
+			_, _, err = r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sr.Status.Upgrade.Phase).Should(Equal(simplev1.UpgradePhaseFailback))
+
+			By("handing the master role back")
+			_, _, err = r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.sent("10.0.0.2")).Should(Equal([]string{"FAILOVER TO 10.0.0.1 6379 TIMEOUT " + failoverTimeout}))
+
+			state.pods[0].info = masterInfo
+			state.pods[1].info = syncedInfo
+			_, _, err = r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sr.Status.Master).Should(Equal("master-a"))
+			Expect(sr.Status.Version).Should(Equal("7.2.4"))
+			Expect(sr.Status.Upgrade).Should(BeNil())
+			Expect(meta.IsStatusConditionFalse(sr.Status.Conditions, simplev1.ConditionUpgrading)).Should(BeTrue())
+		})
+
+		It("should promote with REPLICAOF before 6.2", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{Name: "redis-upgrade", Namespace: redisNamespace},
+				Spec:       simplev1.RedisSpec{Version: "6.2.14", ClusterSize: 2},
+				Status: simplev1.RedisStatus{
+					Master:  "master-a",
+					Version: "6.0.16",
+					Upgrade: &simplev1.UpgradeStatus{From: "6.0.16", To: "6.2.14", Phase: simplev1.UpgradePhaseFailover},
+				},
+			}
+			f := newFakeRedis()
+			r := fakeReconciler(f, sr)
+			state := replicaState{current: 1, pods: []redisPod{
+				fakePod("master-a", "master", "10.0.0.1", "redis:6.0.16-alpine", masterInfo),
+				fakePod("replica-a", "replica", "10.0.0.2", "redis:6.2.14-alpine", syncedInfo),
+			}}
+			_, _, err := r.reconcileUpgrade(ctx, sr, state, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.sent("10.0.0.2")).Should(Equal([]string{"REPLICAOF NO ONE"}))
+			Expect(f.sent("10.0.0.1")).Should(Equal([]string{"REPLICAOF 10.0.0.2 6379"}))
+		})
+	})
+
+	Context("when a failover is requested", func() {
+
+		It("should hand over the master role once and forget the request", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "redis-failover",
+					Namespace:   redisNamespace,
+					Annotations: map[string]string{simplev1.FailoverAnnotation: "replica-a"},
+				},
+				Status: simplev1.RedisStatus{Master: "master-a"},
+			}
+			f := newFakeRedis()
+			r := fakeReconciler(f, sr)
+			state := replicaState{current: 1, pods: []redisPod{
+				fakePod("master-a", "master", "10.0.0.1", "redis:7.0.11-alpine", masterInfo),
+				fakePod("replica-a", "replica", "10.0.0.2", "redis:7.0.11-alpine", syncedInfo),
+			}}
+
+			By("failing over to the requested replica")
+			Expect(r.reconcileFailover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(f.sent("10.0.0.1")).Should(Equal([]string{"FAILOVER TO 10.0.0.2 6379 TIMEOUT " + failoverTimeout}))
+			Expect(sr.Status.Master).Should(Equal("master-a"))
+
+			By("removing the annotation once the replica is the acting master")
+			state.pods[0].info = syncedInfo
+			state.pods[1].info = masterInfo
+			Expect(r.reconcileFailover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(sr.Status.Master).Should(Equal("replica-a"))
+			Expect(sr.Annotations).ShouldNot(HaveKey(simplev1.FailoverAnnotation))
+			stored := &simplev1.Redis{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(sr), stored)).Should(Succeed())
+			Expect(stored.Annotations).ShouldNot(HaveKey(simplev1.FailoverAnnotation))
+
+			By("leaving a later change of the master alone")
+			sr.Status.Master = "master-a"
+			state.pods[0].info = masterInfo
+			state.pods[1].info = syncedInfo
+			Expect(r.reconcileFailover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(sr.Status.Master).Should(Equal("master-a"))
+			Expect(f.sent("10.0.0.1")).Should(HaveLen(1))
+		})
+
+		It("should forget a request for the acting master", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "redis-failover",
+					Namespace:   redisNamespace,
+					Annotations: map[string]string{simplev1.FailoverAnnotation: "master-a"},
+				},
+				Status: simplev1.RedisStatus{Master: "master-a"},
+			}
+			r := fakeReconciler(newFakeRedis(), sr)
+			Expect(r.reconcileFailover(ctx, sr, replicaState{}, nil)).Should(Succeed())
+			Expect(sr.Annotations).ShouldNot(HaveKey(simplev1.FailoverAnnotation))
+		})
+	})
+
+	Context("when the roles are overridden", func() {
+
+		It("should fail back to the master deployment once it is in sync", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{Name: "redis-failback", Namespace: redisNamespace},
+				Spec: simplev1.RedisSpec{
+					Replicas: simplev1.RoleSpec{Config: map[string]string{"appendonly": "yes"}},
+				},
+				Status: simplev1.RedisStatus{Master: "replica-a"},
+			}
+			f := newFakeRedis()
+			r := fakeReconciler(f, sr)
+			state := replicaState{current: 1, pods: []redisPod{
+				fakePod("master-b", "master", "10.0.0.1", "redis:7.0.11-alpine", masterInfo),
+				fakePod("replica-a", "replica", "10.0.0.2", "redis:7.0.11-alpine", masterInfo),
+			}}
+
+			By("waiting for the new master pod to sync")
+			Expect(r.reconcileFailover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(f.sent("10.0.0.2")).Should(BeEmpty())
+			Expect(sr.Status.Master).Should(Equal("replica-a"))
+
+			By("failing back once it is in sync")
+			state.pods[0].info = syncedInfo
+			Expect(r.reconcileFailover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(f.sent("10.0.0.2")).Should(Equal([]string{"FAILOVER TO 10.0.0.1 6379 TIMEOUT " + failoverTimeout}))
+
+			By("recording the master pod once the replica was demoted")
+			state.pods[0].info = masterInfo
+			state.pods[1].info = syncedInfo
+			Expect(r.reconcileFailover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(sr.Status.Master).Should(Equal("master-b"))
+		})
+
+		It("should refuse a failover to a replica", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "redis-failback",
+					Namespace:   redisNamespace,
+					Annotations: map[string]string{simplev1.FailoverAnnotation: "replica-a"},
+				},
+				Spec: simplev1.RedisSpec{
+					Master: simplev1.RoleSpec{Config: map[string]string{"maxmemory": "1gb"}},
+				},
+				Status: simplev1.RedisStatus{Master: "master-a"},
+			}
+			f := newFakeRedis()
+			r := fakeReconciler(f, sr)
+			state := replicaState{current: 1, pods: []redisPod{
+				fakePod("master-a", "master", "10.0.0.1", "redis:7.0.11-alpine", masterInfo),
+				fakePod("replica-a", "replica", "10.0.0.2", "redis:7.0.11-alpine", syncedInfo),
+			}}
+			Expect(r.reconcileFailover(ctx, sr, state, nil)).Should(Succeed())
+			Expect(f.sent("10.0.0.1")).Should(BeEmpty())
+			Expect(sr.Annotations).ShouldNot(HaveKey(simplev1.FailoverAnnotation))
+			Expect(sr.Status.Master).Should(Equal("master-a"))
+		})
+	})
+
+	Context("when namespaces are excluded", func() {
+
+		It("should leave their instances to another operator", func() {
+			r := &RedisReconciler{ExcludeNamespaces: []string{"team-a"}}
+			Expect(r.included(&simplev1.Redis{ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "team-a"}})).Should(BeFalse())
+			Expect(r.included(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "redis-master-0", Namespace: "team-a"}})).Should(BeFalse())
+			Expect(r.included(&simplev1.Redis{ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "team-b"}})).Should(BeTrue())
+			Expect((&RedisReconciler{}).included(&simplev1.Redis{ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "team-a"}})).Should(BeTrue())
+		})
+	})
+
 	Context("when creating a redis instance", func() {
 
 		masterLookup := types.NamespacedName{
@@ -86,6 +586,44 @@ var _ = Describe("redis controller", func() {
 			}, timeout, interval).Should(BeTrue())
 			Expect(mastersvc.ObjectMeta.Name).Should(Equal(resourceMasterName))
 
+			By("creating a replica redis service")
+			replicasvc := &v1.Service{}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, replicaLookup, replicasvc)
+				if err != nil {
+					return false
+				}
+				return true
+			}, timeout, interval).Should(BeTrue())
+			Expect(replicasvc.Spec.Selector).Should(HaveKeyWithValue("simple.simple.redis/role", "replica"))
+
+			By("creating a headless redis service")
+			headlesssvc := &v1.Service{}
+			headlessLookup := types.NamespacedName{Name: redisName + "-headless", Namespace: redisNamespace}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, headlessLookup, headlesssvc)
+				if err != nil {
+					return false
+				}
+				return true
+			}, timeout, interval).Should(BeTrue())
+			Expect(headlesssvc.Spec.ClusterIP).Should(Equal(v1.ClusterIPNone))
+			Expect(headlesssvc.Spec.Selector).ShouldNot(HaveKey("simple.simple.redis/role"))
+
+			By("publishing the connection details in a binding secret")
+			binding := &v1.Secret{}
+			bindingLookup := types.NamespacedName{Name: redisName + "-binding", Namespace: redisNamespace}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, bindingLookup, binding)
+				if err != nil {
+					return false
+				}
+				return true
+			}, timeout, interval).Should(BeTrue())
+			Expect(string(binding.Type)).Should(Equal("servicebinding.io/redis"))
+			Expect(string(binding.Data["host"])).Should(Equal("redis-test-master.default.svc"))
+			Expect(string(binding.Data["uri"])).Should(HavePrefix("redis://redis-test-master.default.svc:"))
+
 			By("creating a replica redis deployment")
 			replicadeploy := &appsv1.Deployment{}
 			Eventually(func() bool {
@@ -97,6 +635,12 @@ var _ = Describe("redis controller", func() {
 			}, timeout, interval).Should(BeTrue())
 			Expect(replicadeploy.ObjectMeta.Name).Should(Equal(resourceReplicaName))
 			Expect(*replicadeploy.Spec.Replicas).Should(Equal(int32(0)))
+
+			By("pointing the replicas at the port the master listens on")
+			Expect(masterdeploy.Spec.Template.Spec.Containers[0].Args).Should(ContainElement("--port 6379"))
+			Expect(masterdeploy.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort).Should(Equal(int32(6379)))
+			Expect(mastersvc.Spec.Ports[0].Port).Should(Equal(int32(6379)))
+			Expect(replicadeploy.Spec.Template.Spec.Containers[0].Args).Should(ContainElement("--replicaof redis-test-master 6379"))
 			Eventually(func() bool {
 				err := k8sClient.Get(ctx, redisLookup, createdRedis)
 				if err != nil {
@@ -105,6 +649,380 @@ var _ = Describe("redis controller", func() {
 				return true
 			}, timeout, interval).Should(BeTrue())
 			Expect(createdRedis.Status.Status).Should(Equal(simplev1.StatusSuccess))
+			Expect(createdRedis.Status.Selector).Should(Equal("simple.simple.redis/name=" + redisName))
+		})
+
+		It("should add replicas one at a time once they are in sync", func() {
+			Expect(nextReplicas(3, replicaState{current: 0})).Should(Equal(1))
+			Expect(nextReplicas(3, replicaState{current: 1, synced: 0})).Should(Equal(1))
+			Expect(nextReplicas(3, replicaState{current: 1, synced: 1})).Should(Equal(2))
+			Expect(nextReplicas(1, replicaState{current: 3, synced: 1})).Should(Equal(1))
+			Expect(nextReplicas(-1, replicaState{})).Should(Equal(0))
+		})
+
+		It("should elect a master deployment pod holding the dataset", func() {
+			pod := func(name, role string, info map[string]string) redisPod {
+				return redisPod{
+					Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{
+						Name:   name,
+						Labels: map[string]string{"simple.simple.redis/role": role},
+					}},
+					info: info,
+				}
+			}
+			synced := map[string]string{"role": "slave", "master_link_status": "up", "master_sync_in_progress": "0"}
+			state := replicaState{pods: []redisPod{
+				pod("replica-a", "replica", synced),
+				pod("master-a", "master", nil),
+				pod("master-b", "master", synced),
+			}}
+			Expect(electMaster(state).Name).Should(Equal("master-b"))
+			Expect(electMaster(replicaState{pods: state.pods[:2]}).Name).Should(Equal("replica-a"))
+			Expect(electMaster(replicaState{pods: []redisPod{state.pods[1], state.pods[0]}}).Name).Should(Equal("replica-a"))
+			Expect(electMaster(replicaState{pods: state.pods[:1]}).Name).Should(Equal("replica-a"))
+			Expect(electMaster(replicaState{})).Should(BeNil())
+		})
+
+		It("should never elect an empty master pod over replicas holding data", func() {
+			pod := func(name, role string, info map[string]string) redisPod {
+				return redisPod{
+					Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{
+						Name:   name,
+						Labels: map[string]string{"simple.simple.redis/role": role},
+					}},
+					info: info,
+				}
+			}
+			empty := map[string]string{"role": "master", "master_repl_offset": "0"}
+			orphaned := map[string]string{"role": "slave", "master_link_status": "down", "master_sync_in_progress": "0", "master_repl_offset": "4242"}
+			behind := map[string]string{"role": "slave", "master_link_status": "down", "master_sync_in_progress": "0", "master_repl_offset": "42"}
+			fresh := map[string]string{"role": "slave", "master_link_status": "down", "master_sync_in_progress": "0", "master_repl_offset": "0"}
+
+			By("electing the most advanced replica whose master was lost")
+			for _, pods := range [][]redisPod{
+				{pod("master-b", "master", empty), pod("replica-a", "replica", behind), pod("replica-b", "replica", orphaned)},
+				{pod("replica-b", "replica", orphaned), pod("replica-a", "replica", behind), pod("master-b", "master", empty)},
+			} {
+				Expect(electMaster(replicaState{pods: pods}).Name).Should(Equal("replica-b"))
+			}
+
+			By("waiting while a pod does not answer yet")
+			Expect(electMaster(replicaState{pods: []redisPod{
+				pod("master-b", "master", empty), pod("replica-a", "replica", nil),
+			}})).Should(BeNil())
+
+			By("electing the empty master pod on the first bootstrap")
+			Expect(electMaster(replicaState{pods: []redisPod{
+				pod("replica-a", "replica", fresh), pod("master-a", "master", empty),
+			}}).Name).Should(Equal("master-a"))
+		})
+	})
+
+	Context("when restoring a redis instance", func() {
+
+		It("should seed the master from the restore source", func() {
+
+			By("creating a redis resource with a restore source")
+			ctx := context.Background()
+			redis := &simplev1.Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-restore",
+					Namespace: redisNamespace,
+				},
+				Spec: simplev1.RedisSpec{
+					RestoreFrom: &simplev1.RestoreSource{
+						URL: "https://backups.example.com/dump.rdb",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("adding the restore init container to the master deployment")
+			masterLookup := types.NamespacedName{Name: "redis-restore-master", Namespace: redisNamespace}
+			masterdeploy := &appsv1.Deployment{}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, masterLookup, masterdeploy)
+				if err != nil {
+					return false
+				}
+				return true
+			}, timeout, interval).Should(BeTrue())
+			Expect(masterdeploy.Spec.Template.Spec.InitContainers).Should(HaveLen(2))
+			Expect(masterdeploy.Spec.Template.Spec.InitContainers[0].Name).Should(Equal("restore-download"))
+			Expect(masterdeploy.Spec.Template.Spec.InitContainers[1].Name).Should(Equal("restore"))
+
+			By("leaving the replicas to sync from the master")
+			replicaLookup := types.NamespacedName{Name: "redis-restore-replica", Namespace: redisNamespace}
+			replicadeploy := &appsv1.Deployment{}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, replicaLookup, replicadeploy)
+				if err != nil {
+					return false
+				}
+				return true
+			}, timeout, interval).Should(BeTrue())
+			Expect(replicadeploy.Spec.Template.Spec.InitContainers).Should(BeEmpty())
+		})
+	})
+
+	Context("when pausing a redis instance", func() {
+
+		It("should only update the status", func() {
+
+			By("creating a paused redis resource")
+			ctx := context.Background()
+			redis := &simplev1.Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-paused",
+					Namespace: redisNamespace,
+				},
+				Spec: simplev1.RedisSpec{
+					Paused: true,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("reporting the paused condition")
+			redisLookup := types.NamespacedName{Name: "redis-paused", Namespace: redisNamespace}
+			createdRedis := &simplev1.Redis{}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, redisLookup, createdRedis)
+				if err != nil {
+					return false
+				}
+				return meta.IsStatusConditionTrue(createdRedis.Status.Conditions, simplev1.ConditionPaused)
+			}, timeout, interval).Should(BeTrue())
+			Expect(meta.FindStatusCondition(createdRedis.Status.Conditions, simplev1.ConditionReconciled)).Should(
+				HaveField("Reason", "Paused"),
+			)
+
+			By("not creating the master deployment")
+			masterLookup := types.NamespacedName{Name: "redis-paused-master", Namespace: redisNamespace}
+			Consistently(func() bool {
+				err := k8sClient.Get(ctx, masterLookup, &appsv1.Deployment{})
+				return errors.IsNotFound(err)
+			}, time.Second*2, interval).Should(BeTrue())
+
+			By("resuming reconciliation")
+			createdRedis.Spec.Paused = false
+			Expect(k8sClient.Update(ctx, createdRedis)).Should(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, masterLookup, &appsv1.Deployment{})
+				if err != nil {
+					return false
+				}
+				return true
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("should not report the paused instance as reconciled", func() {
+			ctx := context.Background()
+			sr := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{Name: "redis-paused", Namespace: redisNamespace},
+				Spec:       simplev1.RedisSpec{ClusterSize: 1, Paused: true},
+				Status:     simplev1.RedisStatus{Status: simplev1.StatusPending},
+			}
+			r := fakeReconciler(newFakeRedis(), sr)
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: sr.Name, Namespace: sr.Namespace}}
+			_, err := r.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, req.NamespacedName, sr)).To(Succeed())
+			cond := meta.FindStatusCondition(sr.Status.Conditions, simplev1.ConditionReconciled)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).Should(Equal(metav1.ConditionUnknown))
+			Expect(cond.Reason).Should(Equal("Paused"))
+
+			By("reporting success once resumed")
+			sr.Spec.Paused = false
+			Expect(r.Update(ctx, sr)).To(Succeed())
+			_, err = r.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, req.NamespacedName, sr)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(sr.Status.Conditions, simplev1.ConditionReconciled)).Should(BeTrue())
+		})
+	})
+
+	Context("when a generated object is changed out-of-band", func() {
+
+		It("should restore it without waiting for the resync", func() {
+
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &simplev1.Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-drift",
+					Namespace: redisNamespace,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("changing the selector of the master service")
+			svcLookup := types.NamespacedName{Name: "redis-drift-master", Namespace: redisNamespace}
+			svc := &v1.Service{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, svcLookup, svc)
+			}, timeout, interval).Should(Succeed())
+			selector := svc.Spec.Selector
+			svc.Spec.Selector = map[string]string{"app": "elsewhere"}
+			Expect(k8sClient.Update(ctx, svc)).Should(Succeed())
+
+			By("restoring the selector and reporting the drift")
+			// the timeout is well below the resync period, only the watch on
+			// the service can trigger the reconcile in time
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, svcLookup, svc)).Should(Succeed())
+				g.Expect(svc.Spec.Selector).Should(Equal(selector))
+			}, timeout, interval).Should(Succeed())
+			// the Drifted condition clears on the next reconcile, the event
+			// stays
+			Eventually(func(g Gomega) {
+				var events v1.EventList
+				g.Expect(k8sClient.List(ctx, &events, client.InNamespace(redisNamespace))).Should(Succeed())
+				var messages []string
+				for _, e := range events.Items {
+					if e.InvolvedObject.Name == "redis-drift" && e.Reason == "Drifted" {
+						messages = append(messages, e.Message)
+					}
+				}
+				g.Expect(messages).Should(ContainElement(ContainSubstring("restored Service redis-drift-master")))
+			}, timeout, interval).Should(Succeed())
+		})
+	})
+
+	Context("when restricting network access", func() {
+
+		It("should generate the network policies", func() {
+
+			By("creating a redis resource with a network policy")
+			ctx := context.Background()
+			redis := &simplev1.Redis{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "simple.simple.redis/v1",
+					Kind:       "Redis",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-netpol",
+					Namespace: redisNamespace,
+				},
+				Spec: simplev1.RedisSpec{
+					NetworkPolicy: &simplev1.NetworkPolicySpec{
+						Clients: []simplev1.NetworkPolicyPeer{
+							{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("allowing the clients to reach the redis port")
+			clients := &networkingv1.NetworkPolicy{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: "redis-netpol-clients", Namespace: redisNamespace}, clients)
+			}, timeout, interval).Should(Succeed())
+			Expect(clients.Spec.Ingress).Should(HaveLen(1))
+			Expect(clients.Spec.Ingress[0].From[0].PodSelector.MatchLabels).Should(HaveKeyWithValue("app", "web"))
+
+			By("allowing replication between the pods of the instance")
+			replication := &networkingv1.NetworkPolicy{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, types.NamespacedName{Name: "redis-netpol-replication", Namespace: redisNamespace}, replication)
+			}, timeout, interval).Should(Succeed())
+			Expect(replication.Spec.Ingress[0].From).Should(HaveLen(2))
+
+			By("not allowing metrics scraping without a metrics namespace")
+			Consistently(func() bool {
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: "redis-netpol-metrics", Namespace: redisNamespace}, &networkingv1.NetworkPolicy{})
+				return errors.IsNotFound(err)
+			}, time.Second*2, interval).Should(BeTrue())
+		})
+	})
+
+	Context("when the API server fails", func() {
+
+		failServices := func(err error) func(obj client.Object) error {
+			return func(obj client.Object) error {
+				if _, ok := obj.(*v1.Service); ok {
+					return err
+				}
+				return nil
+			}
+		}
+		reconcileWith := func(name string, err error) (ctrl.Result, error) {
+			reconciler := &RedisReconciler{
+				Client: faultyClient{Client: k8sClient, fails: failServices(err)},
+				Scheme: scheme.Scheme,
+			}
+			return reconciler.Reconcile(context.Background(), ctrl.Request{
+				NamespacedName: types.NamespacedName{Name: name, Namespace: redisNamespace},
+			})
+		}
+
+		It("should return transient errors to retry with backoff", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-unavailable",
+					Namespace: redisNamespace,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("failing the service writes")
+			Eventually(func() error {
+				_, err := reconcileWith("redis-unavailable", errors.NewServiceUnavailable("injected failure"))
+				return err
+			}, timeout, interval).Should(MatchError(ContainSubstring("injected failure")))
+		})
+
+		It("should only retry permanent errors on the resync", func() {
+			By("creating a redis resource")
+			ctx := context.Background()
+			redis := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "redis-invalid",
+					Namespace: redisNamespace,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			By("rejecting the services as invalid")
+			invalid := errors.NewInvalid(schema.GroupKind{Kind: "Service"}, "redis-invalid-master", field.ErrorList{
+				field.Invalid(field.NewPath("spec", "ports"), nil, "injected failure"),
+			})
+			Eventually(func(g Gomega) {
+				result, err := reconcileWith("redis-invalid", invalid)
+				g.Expect(err).ShouldNot(HaveOccurred())
+				g.Expect(result).Should(Equal(ctrl.Result{RequeueAfter: DefaultResyncPeriod}))
+			}, timeout, interval).Should(Succeed())
+		})
+
+		It("should classify the collected errors", func() {
+			invalid := errors.NewInvalid(schema.GroupKind{Kind: "Service"}, "redis", nil)
+			unavailable := errors.NewServiceUnavailable("unavailable")
+			transient, permanent := classify(fmt.Errorf("wrapped: %w", invalid))
+			Expect(transient).ShouldNot(HaveOccurred())
+			Expect(permanent).Should(HaveOccurred())
+
+			var errs error
+			errs = multierror.Append(errs, unavailable)
+			errs = multierror.Append(errs, multierror.Append(nil, invalid))
+			transient, permanent = classify(errs)
+			Expect(transient).Should(MatchError(ContainSubstring("unavailable")))
+			Expect(permanent).Should(MatchError(ContainSubstring("redis")))
+			Expect(permanent.Error()).ShouldNot(ContainSubstring("unavailable"))
 		})
 	})
 })
@@ -0,0 +1,66 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/spazzy757/simple-redis/api/config/v1alpha1"
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// RenderedSecretPlaceholder replaces secret values that only exist in the
+// cluster when rendering offline
+const RenderedSecretPlaceholder = "<generated in cluster>"
+
+// Render used to generate the objects the operator manages for a redis
+// instance without a cluster: the deployments at their desired size and
+// version, the services, network policies, binding, restore state and admin
+// secret. Owner references are left out as the instance has no UID yet
+func Render(sr simplev1.Redis, defaults configv1alpha1.RedisDefaults, operatorNamespace string) ([]client.Object, error) {
+	version := redisVersion(sr)
+	replicas := sr.Spec.ClusterSize - 1
+	if replicas < 0 {
+		replicas = 0
+	}
+	objs, _, err := topologyFor(nil, sr).objects(sr, versions{master: version, replica: version}, replicas, defaults)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range networkPolicies(sr, operatorNamespace) {
+		if p.enabled {
+			objs = append(objs, p.policy)
+		}
+	}
+	password := ""
+	if sr.Spec.Auth != nil {
+		password = RenderedSecretPlaceholder
+	}
+	secret, cm := binding(sr, password)
+	objs = append(objs, secret)
+	if sr.Spec.Binding.ConfigMap {
+		objs = append(objs, cm)
+	}
+	if sr.Spec.RestoreFrom != nil {
+		objs = append(objs, restoreState(sr))
+	}
+	if sr.Spec.CommandPolicy != nil {
+		objs = append(objs, iredis.GenerateAdminSecret(sr.Name, sr.Namespace, RenderedSecretPlaceholder))
+	}
+	return objs, nil
+}
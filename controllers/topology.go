@@ -0,0 +1,153 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/spazzy757/simple-redis/api/config/v1alpha1"
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// versions are the redis versions each role runs, they differ while an
+// upgrade is in progress
+type versions struct {
+	master  string
+	replica string
+}
+
+// topology describes how a mode lays out a redis instance: the objects it
+// consists of and the runtime actions moving the observed pods towards the
+// spec
+type topology interface {
+	// upgrade moves a version change forward and returns the versions the
+	// roles run
+	upgrade(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) (versions, error)
+	// failover hands the master role to the pod requested through the
+	// failover annotation
+	failover(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error
+	// bootstrap makes sure exactly one pod acts as master and the others
+	// replicate from it
+	bootstrap(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error
+	// scale returns the amount of replicas to run next and whether that
+	// is the desired amount
+	scale(sr simplev1.Redis, state replicaState) (int, bool)
+	// objects returns the objects to create or update and the objects of
+	// other modes to remove
+	objects(sr simplev1.Redis, v versions, replicas int, defaults configv1alpha1.RedisDefaults) (apply, remove []client.Object, err error)
+}
+
+// topologyFor used to pick the topology of the mode of an instance, the
+// reconciler may be nil when only objects are generated. Sentinel and sharded
+// cluster are not implemented yet, the enum of spec.mode only admits the
+// modes handled here
+func topologyFor(r *RedisReconciler, sr simplev1.Redis) topology {
+	if sr.Spec.Mode == simplev1.ModeStandalone {
+		return standalone{r}
+	}
+	return replication{r}
+}
+
+// replication runs a master deployment and a replica deployment whose pods
+// follow the acting master, the master role moves between pods on failover
+// and during upgrades
+type replication struct {
+	r *RedisReconciler
+}
+
+func (t replication) upgrade(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) (versions, error) {
+	master, replica, err := t.r.reconcileUpgrade(ctx, sr, state, creds)
+	return versions{master: master, replica: replica}, err
+}
+
+func (t replication) failover(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error {
+	return t.r.reconcileFailover(ctx, sr, state, creds)
+}
+
+func (t replication) bootstrap(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error {
+	return t.r.reconcileMaster(ctx, sr, state, creds)
+}
+
+func (replication) scale(sr simplev1.Redis, state replicaState) (int, bool) {
+	desired := sr.Spec.ClusterSize - 1
+	replicas := nextReplicas(desired, state)
+	return replicas, replicas >= desired
+}
+
+func (replication) objects(sr simplev1.Redis, v versions, replicas int, defaults configv1alpha1.RedisDefaults) (apply, remove []client.Object, err error) {
+	master, err := masterDeployment(sr, v.master, defaults)
+	if err != nil {
+		return nil, nil, err
+	}
+	replica, err := replicaDeployment(sr, v.replica, replicas, defaults)
+	if err != nil {
+		return nil, nil, err
+	}
+	apply = []client.Object{master, replica}
+	for _, svc := range services(sr) {
+		apply = append(apply, svc)
+	}
+	return apply, nil, nil
+}
+
+// standalone runs the master deployment only. Upgrades replace the master
+// pod once the new one synced the dataset from it, there is no replica to
+// fail over to
+type standalone struct {
+	r *RedisReconciler
+}
+
+func (t standalone) upgrade(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) (versions, error) {
+	master, replica, err := t.r.reconcileUpgrade(ctx, sr, state, creds)
+	return versions{master: master, replica: replica}, err
+}
+
+func (standalone) failover(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error {
+	return nil
+}
+
+func (t standalone) bootstrap(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) error {
+	return t.r.reconcileMaster(ctx, sr, state, creds)
+}
+
+func (standalone) scale(sr simplev1.Redis, state replicaState) (int, bool) {
+	return 0, true
+}
+
+func (standalone) objects(sr simplev1.Redis, v versions, replicas int, defaults configv1alpha1.RedisDefaults) (apply, remove []client.Object, err error) {
+	master, err := masterDeployment(sr, v.master, defaults)
+	if err != nil {
+		return nil, nil, err
+	}
+	apply = []client.Object{master}
+	for _, svc := range services(sr) {
+		if svc.Name == iredis.ResourceName(sr.Name, "replica") {
+			remove = append(remove, svc)
+			continue
+		}
+		apply = append(apply, svc)
+	}
+	replica := &appsv1.Deployment{}
+	replica.Name = iredis.ResourceName(sr.Name, "replica")
+	replica.Namespace = sr.Namespace
+	remove = append(remove, replica)
+	return apply, remove, nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// failoverTimeout bounds how long the master pauses writes while waiting for
+// the target replica to catch up during a FAILOVER
+const failoverTimeout = "10000"
+
+// reconcileUpgrade used to move a rolling upgrade through its phases. It
+// returns the versions the master and replica deployments should run:
+// replicas are upgraded first, one at a time, then the master role is handed
+// to an upgraded replica so the master deployment can be upgraded without
+// losing writes, and finally the master role is handed back
+func (r *RedisReconciler) reconcileUpgrade(ctx context.Context, sr *simplev1.Redis, state replicaState, creds []iredis.Credentials) (string, string, error) {
+	log := log.FromContext(ctx)
+	target := redisVersion(*sr)
+	if sr.Status.Version == "" {
+		sr.Status.Version = target
+	}
+	up := sr.Status.Upgrade
+	if up == nil {
+		if sr.Status.Version == target {
+			return target, target, nil
+		}
+		up = &simplev1.UpgradeStatus{
+			From:  sr.Status.Version,
+			To:    target,
+			Phase: simplev1.UpgradePhaseReplicas,
+		}
+		sr.Status.Upgrade = up
+		log.Info("starting upgrade", "from", up.From, "to", up.To)
+	}
+
+	image := redisImage(*sr, r.defaults(), up.To)
+	var err error
+	switch up.Phase {
+	case simplev1.UpgradePhaseReplicas:
+		if replicasUpgraded(state, image) {
+			up.Phase = simplev1.UpgradePhaseFailover
+			if state.current == 0 {
+				// without replicas there is nothing to fail over to, the new
+				// master pod syncs from the old one before it is replaced
+				up.Phase = simplev1.UpgradePhaseMaster
+			}
+		}
+	case simplev1.UpgradePhaseFailover:
+		target := upgradedReplica(state, image)
+		if target == nil {
+			break
+		}
+		if target.role() == "master" {
+			log.Info("failed over to upgraded replica", "pod", target.Name)
+			sr.Status.Master = target.Name
+			up.Phase = simplev1.UpgradePhaseMaster
+			break
+		}
+		err = r.failover(ctx, *sr, state, target, up.From, creds)
+	case simplev1.UpgradePhaseMaster:
+		if p := upgradedMaster(state, image); p != nil && (p.inSync() || p.Name == sr.Status.Master) {
+			up.Phase = simplev1.UpgradePhaseFailback
+		}
+	case simplev1.UpgradePhaseFailback:
+		target := upgradedMaster(state, image)
+		if target == nil {
+			break
+		}
+		if target.Name != sr.Status.Master && target.role() != "master" {
+			err = r.failover(ctx, *sr, state, target, up.To, creds)
+			break
+		}
+		log.Info("finished upgrade", "from", up.From, "to", up.To)
+		sr.Status.Master = target.Name
+		sr.Status.Version = up.To
+		sr.Status.Upgrade = nil
+		meta.SetStatusCondition(&sr.Status.Conditions, metav1.Condition{
+			Type:               simplev1.ConditionUpgrading,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: sr.Generation,
+			Reason:             "UpgradeSucceeded",
+			Message:            fmt.Sprintf("upgraded from %v to %v", up.From, up.To),
+		})
+		return up.To, up.To, err
+	}
+
+	meta.SetStatusCondition(&sr.Status.Conditions, metav1.Condition{
+		Type:               simplev1.ConditionUpgrading,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sr.Generation,
+		Reason:             string(up.Phase),
+		Message:            fmt.Sprintf("upgrading from %v to %v", up.From, up.To),
+	})
+	switch up.Phase {
+	case simplev1.UpgradePhaseReplicas, simplev1.UpgradePhaseFailover:
+		return up.From, up.To, err
+	}
+	return up.To, up.To, err
+}
+
+// failover used to hand the master role from the acting master, running the
+// given version, to the target pod. FAILOVER pauses writes until the target
+// caught up and turns the old master into a replica of the target. Before
+// 6.2 the target is promoted with REPLICAOF NO ONE instead and the old master
+// is pointed at it, writes reaching the old master in between are lost
+func (r *RedisReconciler) failover(ctx context.Context, sr simplev1.Redis, state replicaState, target *redisPod, version string, creds []iredis.Credentials) error {
+	current := state.pod(sr.Status.Master)
+	if current == nil {
+		return fmt.Errorf("acting master %v not found", sr.Status.Master)
+	}
+	if !target.inSync() {
+		return nil
+	}
+	log := log.FromContext(ctx)
+	port := redisPort(sr)
+	if !simplev1.AtLeast(simplev1.CompatibleVersion(sr.Spec.Engine, version), "6.2") {
+		log.Info("promoting replica", "from", current.Name, "to", target.Name)
+		if err := r.do(ctx, target.Pod, port, creds, "REPLICAOF", "NO", "ONE"); err != nil {
+			return fmt.Errorf("promoting %v: %w", target.Name, err)
+		}
+		return r.do(ctx, current.Pod, port, creds, "REPLICAOF", target.Status.PodIP, strconv.Itoa(port))
+	}
+	log.Info("failing over", "from", current.Name, "to", target.Name)
+	err := r.do(ctx, current.Pod, port, creds,
+		"FAILOVER", "TO", target.Status.PodIP, strconv.Itoa(port), "TIMEOUT", failoverTimeout,
+	)
+	// a failover started by a previous reconcile is still running
+	if err != nil && strings.Contains(err.Error(), "already in progress") {
+		return nil
+	}
+	return err
+}
+
+// replicasUpgraded used to check that every replica runs the image and
+// finished syncing
+func replicasUpgraded(state replicaState, image string) bool {
+	count := 0
+	for _, p := range state.pods {
+		if p.Labels[iredis.RoleLabel] != "replica" {
+			continue
+		}
+		if p.Spec.Containers[0].Image != image || !p.inSync() {
+			return false
+		}
+		count++
+	}
+	return count == state.current
+}
+
+// upgradedReplica used to pick the replica to fail over to during an upgrade
+func upgradedReplica(state replicaState, image string) *redisPod {
+	for i := range state.pods {
+		p := &state.pods[i]
+		if p.Labels[iredis.RoleLabel] == "replica" && p.Spec.Containers[0].Image == image && p.info != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// upgradedMaster used to find the pod of the master deployment running the
+// image
+func upgradedMaster(state replicaState, image string) *redisPod {
+	for i := range state.pods {
+		p := &state.pods[i]
+		if p.Labels[iredis.RoleLabel] == "master" && p.Spec.Containers[0].Image == image && p.info != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// runningVersion used to get the version the acting master runs outside of
+// upgrades, as recorded in the status
+func runningVersion(sr simplev1.Redis) string {
+	if sr.Status.Version == "" {
+		return redisVersion(sr)
+	}
+	return sr.Status.Version
+}
+
+// redisVersion used to get the version to run, falling back to the default
+// when the spec was not defaulted by the webhook
+func redisVersion(sr simplev1.Redis) string {
+	if sr.Spec.Version == "" {
+		return simplev1.DefaultVersion
+	}
+	return sr.Spec.Version
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	configv1alpha1 "github.com/spazzy757/simple-redis/api/config/v1alpha1"
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+)
+
+// DefaultReloadInterval is how often the config file is checked for changes
+const DefaultReloadInterval = 10 * time.Second
+
+var (
+	scheme = runtime.NewScheme()
+	codecs = serializer.NewCodecFactory(scheme, serializer.EnableStrict)
+)
+
+func init() {
+	if err := configv1alpha1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+}
+
+// Store holds the operator config loaded from a file, typically a mounted
+// config map, and reloads it when the file changes
+type Store struct {
+	path     string
+	interval time.Duration
+
+	mu       sync.RWMutex
+	config   configv1alpha1.OperatorConfig
+	contents []byte
+	loaded   bool
+}
+
+// NewStore used to load the config file at path, an empty path or a missing
+// file results in an empty config
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, interval: DefaultReloadInterval}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Defaults used to get the current fleet wide defaults
+func (s *Store) Defaults() configv1alpha1.RedisDefaults {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return *s.config.Defaults.DeepCopy()
+}
+
+// Start used to reload the config file until the context is done, it
+// implements manager.Runnable. An invalid file is logged and the previous
+// config is kept
+func (s *Store) Start(ctx context.Context) error {
+	log := logf.FromContext(ctx).WithName("config")
+	if s.path == "" {
+		return nil
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			changed, err := s.reload()
+			if err != nil {
+				log.Error(err, "unable to reload the operator config, keeping the previous one", "path", s.path)
+			} else if changed {
+				log.Info("reloaded the operator config", "path", s.path)
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica
+// serves the webhooks and needs the current config
+func (s *Store) NeedLeaderElection() bool {
+	return false
+}
+
+// reload used to read the config file, reporting whether it changed
+func (s *Store) reload() (bool, error) {
+	if s.path == "" {
+		return false, nil
+	}
+	contents, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		contents = nil
+	} else if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	unchanged := s.loaded && bytes.Equal(contents, s.contents)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	config, err := Parse(contents)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse %v: %w", s.path, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = *config
+	s.contents = contents
+	s.loaded = true
+	return true, nil
+}
+
+// Parse used to decode a versioned operator config, unknown fields are
+// refused so typos do not silently fall back to the built in defaults
+func Parse(contents []byte) (*configv1alpha1.OperatorConfig, error) {
+	config := &configv1alpha1.OperatorConfig{}
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return config, nil
+	}
+	if err := runtime.DecodeInto(codecs.UniversalDecoder(), contents, config); err != nil {
+		return nil, err
+	}
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// validate used to check the defaults are valid values for a redis spec, the
+// defaulting webhook would otherwise produce resources it then rejects
+func validate(config *configv1alpha1.OperatorConfig) error {
+	var errs field.ErrorList
+	path := field.NewPath("defaults")
+	defaults := config.Defaults
+	if defaults.Version != "" {
+		if _, err := simplev1.RDBVersion(defaults.Version); err != nil {
+			errs = append(errs, field.Invalid(path.Child("version"), defaults.Version, err.Error()))
+		}
+	}
+	switch simplev1.RedisLogLevel(defaults.LogLevel) {
+	case "", simplev1.RLogLevelDebug, simplev1.RLogLevelNotice, simplev1.RLogLevelWarning, simplev1.RLogLevelVerbose:
+	default:
+		errs = append(errs, field.Invalid(path.Child("logLevel"), defaults.LogLevel, "logLevel needs to be one of [debug,notice,verbose,warning]"))
+	}
+	return errs.ToAggregate()
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("operator config", func() {
+
+	const config = `apiVersion: config.simple.redis/v1alpha1
+kind: OperatorConfig
+defaults:
+  version: 7.0.11
+  image: registry.example.com/redis
+  resources:
+    requests:
+      memory: 256Mi
+`
+
+	Context("when parsing a config file", func() {
+
+		It("should decode the defaults", func() {
+			parsed, err := Parse([]byte(config))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parsed.Defaults.Version).Should(Equal("7.0.11"))
+			Expect(parsed.Defaults.Image).Should(Equal("registry.example.com/redis"))
+			Expect(parsed.Defaults.Resources.Requests.Memory().Equal(resource.MustParse("256Mi"))).Should(BeTrue())
+		})
+
+		It("should refuse unknown fields and kinds", func() {
+			_, err := Parse([]byte(config + "  storageClas: fast\n"))
+			Expect(err).Should(HaveOccurred())
+			_, err = Parse([]byte("apiVersion: config.simple.redis/v1alpha1\nkind: Other\n"))
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should refuse defaults the webhook would reject", func() {
+			_, err := Parse([]byte("apiVersion: config.simple.redis/v1alpha1\nkind: OperatorConfig\ndefaults:\n  version: 1.0.0\n"))
+			Expect(err).Should(MatchError(ContainSubstring("defaults.version")))
+		})
+	})
+
+	Context("when reloading a config file", func() {
+
+		It("should pick up changes and keep the last valid config", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+			store, err := NewStore(path)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(store.Defaults().Version).Should(BeEmpty())
+
+			Expect(os.WriteFile(path, []byte(config), 0o600)).Should(Succeed())
+			changed, err := store.reload()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(changed).Should(BeTrue())
+			Expect(store.Defaults().Version).Should(Equal("7.0.11"))
+
+			changed, err = store.reload()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(changed).Should(BeFalse())
+
+			Expect(os.WriteFile(path, []byte("defaults: ["), 0o600)).Should(Succeed())
+			_, err = store.reload()
+			Expect(err).Should(HaveOccurred())
+			Expect(store.Defaults().Version).Should(Equal("7.0.11"))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// configDiff is a directive whose running value differs from the spec
+type configDiff struct {
+	name, spec, live string
+}
+
+// ConfigDiff used to compare the directives rendered from the spec with the
+// values the acting master runs with, as changed at runtime with CONFIG SET
+func (p *Plugin) ConfigDiff(ctx context.Context, name string) error {
+	sr, err := p.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods, err := p.pods(ctx, sr)
+	if err != nil {
+		return err
+	}
+	pod, err := master(sr, pods)
+	if err != nil {
+		return err
+	}
+	auth := authFor(sr)
+	out, err := p.redisCLI(ctx, sr, pod, auth, command(sr, "CONFIG"), "GET", "*")
+	if err != nil {
+		return err
+	}
+	diffs := diffConfig(desiredConfig(sr, pod), parseConfig(out))
+	if len(diffs) == 0 {
+		fmt.Fprintf(p.Streams.Out, "%v runs with the configuration of redis/%v\n", pod.Name, sr.Name)
+		return nil
+	}
+	w := tabwriter.NewWriter(p.Streams.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "DIRECTIVE\tSPEC\tLIVE (%v)\n", pod.Name)
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", d.name, d.spec, d.live)
+	}
+	return w.Flush()
+}
+
+// desiredConfig used to get the directives the operator renders from the spec
+// for the deployment a pod belongs to, a replica elected as master keeps the
+// overrides of the replicas
+func desiredConfig(sr *simplev1.Redis, pod *corev1.Pod) map[string]string {
+	role := sr.Spec.Master
+	if pod.Labels[iredis.RoleLabel] == "replica" {
+		role = sr.Spec.Replicas
+	}
+	desired := sr.Spec.RoleConfig(role)
+	if sr.Spec.LogLevel != "" {
+		desired["loglevel"] = string(sr.Spec.LogLevel)
+	}
+	if sr.Spec.Databases != 0 {
+		desired["databases"] = strconv.Itoa(sr.Spec.Databases)
+	}
+	desired["port"] = strconv.Itoa(port(sr))
+	return desired
+}
+
+// parseConfig used to read the name and value pairs printed by CONFIG GET
+func parseConfig(out string) map[string]string {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	config := make(map[string]string, len(lines)/2)
+	for i := 0; i+1 < len(lines); i += 2 {
+		config[lines[i]] = lines[i+1]
+	}
+	return config
+}
+
+// diffConfig used to list the desired directives with a different live value,
+// ordered by name
+func diffConfig(desired, live map[string]string) []configDiff {
+	var diffs []configDiff
+	for name, value := range desired {
+		current, ok := live[name]
+		if !ok {
+			current = "<unset>"
+		} else if normalize(value) == normalize(current) {
+			continue
+		}
+		diffs = append(diffs, configDiff{name: name, spec: value, live: current})
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].name < diffs[j].name
+	})
+	return diffs
+}
+
+// byteSize matches the byte sizes redis accepts
+var byteSize = regexp.MustCompile(`^([0-9]+)(b|k|kb|m|mb|g|gb)?$`)
+
+// byteUnits maps the units of a byte size to their multiplier
+var byteUnits = map[string]int64{
+	"":   1,
+	"b":  1,
+	"k":  1000,
+	"kb": 1024,
+	"m":  1000 * 1000,
+	"mb": 1024 * 1024,
+	"g":  1000 * 1000 * 1000,
+	"gb": 1024 * 1024 * 1024,
+}
+
+// normalize used to compare values the way redis reports them, sizes are
+// reported in bytes, names in lower case and empty values unquoted
+func normalize(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == `""` {
+		return ""
+	}
+	if m := byteSize.FindStringSubmatch(value); m != nil {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err == nil {
+			return strconv.FormatInt(n*byteUnits[m[2]], 10)
+		}
+	}
+	return value
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// NewExecutor used to run commands in pods through the exec subresource, the
+// same way kubectl exec does
+func NewExecutor(cfg *rest.Config) (Executor, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, pod types.NamespacedName, container string, command []string, streams Streams) error {
+		req := clientset.CoreV1().RESTClient().Post().
+			Resource("pods").
+			Name(pod.Name).
+			Namespace(pod.Namespace).
+			SubResource("exec").
+			VersionedParams(&corev1.PodExecOptions{
+				Container: container,
+				Command:   command,
+				Stdin:     streams.In != nil,
+				Stdout:    streams.Out != nil,
+				Stderr:    streams.ErrOut != nil && !streams.TTY,
+				TTY:       streams.TTY,
+			}, scheme.ParameterCodec)
+		exec, err := remotecommand.NewSPDYExecutor(cfg, "POST", req.URL())
+		if err != nil {
+			return err
+		}
+		opts := remotecommand.StreamOptions{
+			Stdin:  streams.In,
+			Stdout: streams.Out,
+			Tty:    streams.TTY,
+		}
+		if !streams.TTY {
+			opts.Stderr = streams.ErrOut
+		}
+		return exec.StreamWithContext(ctx, opts)
+	}, nil
+}
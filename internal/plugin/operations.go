@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// pollInterval is how often the plugin checks on a running operation
+const pollInterval = time.Second
+
+// CLI used to run the CLI of the engine in the acting master, interactively
+// when no arguments are given
+func (p *Plugin) CLI(ctx context.Context, name string, args []string) error {
+	sr, err := p.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods, err := p.pods(ctx, sr)
+	if err != nil {
+		return err
+	}
+	pod, err := master(sr, pods)
+	if err != nil {
+		return err
+	}
+	auth := authFor(sr)
+	return p.Exec(ctx, client.ObjectKeyFromObject(pod), redisContainer, cliCommand(sr, auth, args...), p.Streams)
+}
+
+// Failover used to request the operator to hand the master role to a pod,
+// an in sync replica is picked when no pod is given. The operator fails over
+// once the pod finished syncing, with a timeout the call blocks until it did
+func (p *Plugin) Failover(ctx context.Context, name, to string, timeout time.Duration) error {
+	sr, err := p.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods, err := p.pods(ctx, sr)
+	if err != nil {
+		return err
+	}
+	target, err := failoverTarget(sr, pods, to)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(sr.DeepCopy())
+	if sr.Annotations == nil {
+		sr.Annotations = map[string]string{}
+	}
+	sr.Annotations[simplev1.FailoverAnnotation] = target
+	if err := p.Client.Patch(ctx, sr, patch); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.Streams.Out, "requested failover of redis/%v to %v\n", sr.Name, target)
+	if timeout == 0 {
+		return nil
+	}
+	err = wait.PollImmediateWithContext(ctx, pollInterval, timeout, func(ctx context.Context) (bool, error) {
+		sr, err := p.get(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		return sr.Status.Master == target, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for %v to become master: %w", target, err)
+	}
+	fmt.Fprintf(p.Streams.Out, "%v is the acting master\n", target)
+	return nil
+}
+
+// failoverTarget used to validate the requested pod or pick the first replica
+// the operator reports in sync, with role overrides only pods of the master
+// deployment qualify
+func failoverTarget(sr *simplev1.Redis, pods []corev1.Pod, to string) (string, error) {
+	for _, pod := range pods {
+		if to != "" && pod.Name != to {
+			continue
+		}
+		if pod.Name == sr.Status.Master {
+			if to != "" {
+				return "", fmt.Errorf("%v is already the acting master", to)
+			}
+			continue
+		}
+		// the operator refuses to hand the master role to a replica running
+		// with the overrides of the replicas
+		if sr.Spec.RolesOverridden() && pod.Labels[iredis.RoleLabel] != "master" {
+			if to != "" {
+				return "", fmt.Errorf("%v runs with the overrides of the replicas", to)
+			}
+			continue
+		}
+		if to != "" || inSync(pod) {
+			return pod.Name, nil
+		}
+	}
+	if to != "" {
+		return "", fmt.Errorf("pod %v is not part of redis %v", to, sr.Name)
+	}
+	return "", fmt.Errorf("redis %v has no replica in sync to fail over to", sr.Name)
+}
+
+// inSync used to check the readiness gate the operator sets once a replica
+// finished syncing
+func inSync(pod corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == iredis.InSyncCondition {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// SetPaused used to pause or resume the reconciliation of an instance
+func (p *Plugin) SetPaused(ctx context.Context, name string, paused bool) error {
+	sr, err := p.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(sr.DeepCopy())
+	sr.Spec.Paused = paused
+	if err := p.Client.Patch(ctx, sr, patch); err != nil {
+		return err
+	}
+	state := "resumed"
+	if paused {
+		state = "paused"
+	}
+	if !paused && sr.Annotations[simplev1.PausedAnnotation] == "true" {
+		fmt.Fprintf(p.Streams.ErrOut, "warning: redis/%v stays paused through the %v annotation\n", sr.Name, simplev1.PausedAnnotation)
+	}
+	fmt.Fprintf(p.Streams.Out, "redis/%v %v\n", sr.Name, state)
+	return nil
+}
+
+// Backup used to take a snapshot on the acting master with BGSAVE and copy
+// the resulting dump.rdb to out
+func (p *Plugin) Backup(ctx context.Context, name string, out io.Writer, timeout time.Duration) error {
+	sr, err := p.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods, err := p.pods(ctx, sr)
+	if err != nil {
+		return err
+	}
+	pod, err := master(sr, pods)
+	if err != nil {
+		return err
+	}
+	auth := authFor(sr)
+	reply, err := p.redisCLI(ctx, sr, pod, auth, command(sr, "BGSAVE"))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(reply), "Background saving started") {
+		return fmt.Errorf("BGSAVE on %v was refused: %v", pod.Name, strings.TrimSpace(reply))
+	}
+	// the reply is only sent once the save was forked, so it is done as soon
+	// as no save is in progress. LASTSAVE only has a resolution of seconds
+	// and cannot tell saves within the same second apart
+	fmt.Fprintf(p.Streams.ErrOut, "waiting for BGSAVE on %v\n", pod.Name)
+	err = wait.PollImmediateWithContext(ctx, pollInterval, timeout, func(ctx context.Context) (bool, error) {
+		out, err := p.redisCLI(ctx, sr, pod, auth, "INFO", "persistence")
+		if err != nil {
+			return false, err
+		}
+		info := iredis.ParseInfo(out)
+		if info["rdb_bgsave_in_progress"] != "0" {
+			return false, nil
+		}
+		if status := info["rdb_last_bgsave_status"]; status != "ok" {
+			return false, fmt.Errorf("BGSAVE on %v failed with status %v", pod.Name, status)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return p.Exec(ctx, client.ObjectKeyFromObject(pod), redisContainer, []string{"cat", iredis.DumpPath}, Streams{
+		Out:    out,
+		ErrOut: p.Streams.ErrOut,
+	})
+}
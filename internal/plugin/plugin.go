@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// redisContainer is the name of the redis container in the redis pods
+const redisContainer = "redis"
+
+// Streams are the standard streams of a command
+type Streams struct {
+	In     io.Reader
+	Out    io.Writer
+	ErrOut io.Writer
+	// TTY allocates a terminal for interactive commands
+	TTY bool
+}
+
+// Executor runs a command in a container of a pod
+type Executor func(ctx context.Context, pod types.NamespacedName, container string, command []string, streams Streams) error
+
+// Plugin implements the kubectl-redis commands against the redis instances
+// of a namespace
+type Plugin struct {
+	Client    client.Client
+	Exec      Executor
+	Namespace string
+	Streams   Streams
+}
+
+// get used to fetch a redis instance by name
+func (p *Plugin) get(ctx context.Context, name string) (*simplev1.Redis, error) {
+	var sr simplev1.Redis
+	if err := p.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: p.Namespace}, &sr); err != nil {
+		return nil, err
+	}
+	return &sr, nil
+}
+
+// pods used to list the pods of a redis instance ordered by name
+func (p *Plugin) pods(ctx context.Context, sr *simplev1.Redis) ([]corev1.Pod, error) {
+	var pods corev1.PodList
+	err := p.Client.List(ctx, &pods,
+		client.InNamespace(sr.Namespace),
+		client.MatchingLabels(iredis.InstanceLabels(sr.Name)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	return pods.Items, nil
+}
+
+// master used to find the acting master among the pods, as recorded in the
+// status or labelled by the operator
+func master(sr *simplev1.Redis, pods []corev1.Pod) (*corev1.Pod, error) {
+	for i := range pods {
+		if pods[i].Name == sr.Status.Master {
+			return &pods[i], nil
+		}
+	}
+	for i := range pods {
+		if pods[i].Labels[iredis.MasterLabel] == "true" {
+			return &pods[i], nil
+		}
+	}
+	return nil, fmt.Errorf("redis %v has no acting master", sr.Name)
+}
+
+// cliAuth is how the CLI authenticates against a redis pod, the password is
+// taken from the environment of the redis container
+type cliAuth struct {
+	user        string
+	passwordEnv string
+}
+
+// authFor used to pick the user and password the CLI authenticates with, the
+// admin user is used once a command policy may restrict the default user
+func authFor(sr *simplev1.Redis) cliAuth {
+	switch {
+	case sr.Spec.CommandPolicy != nil:
+		return cliAuth{user: iredis.AdminUser, passwordEnv: iredis.AdminPasswordEnv}
+	case sr.Spec.Auth != nil:
+		return cliAuth{passwordEnv: iredis.PasswordEnv}
+	}
+	return cliAuth{}
+}
+
+// port used to get the port redis listens on
+func port(sr *simplev1.Redis) int {
+	if sr.Spec.Port == 0 {
+		return iredis.DefaultPort
+	}
+	return sr.Spec.Port
+}
+
+// command used to get the name a command is served under, following the
+// renames of the command policy
+func command(sr *simplev1.Redis, name string) string {
+	if policy := sr.Spec.CommandPolicy; policy != nil {
+		for from, to := range policy.Renamed {
+			if strings.EqualFold(from, name) {
+				return to
+			}
+		}
+	}
+	return name
+}
+
+// cliCommand used to build the invocation of the CLI of the engine for a
+// redis pod, with a password the CLI is started through a shell reading it
+// into REDISCLI_AUTH so it is never part of the exec request or the process
+// list
+func cliCommand(sr *simplev1.Redis, auth cliAuth, args ...string) []string {
+	cli := iredis.EngineFor(string(sr.Spec.Engine)).CLI
+	cmd := []string{cli, "-p", strconv.Itoa(port(sr))}
+	if auth.user != "" {
+		cmd = append(cmd, "--user", auth.user)
+	}
+	if auth.passwordEnv == "" {
+		return append(cmd, args...)
+	}
+	script := fmt.Sprintf(`REDISCLI_AUTH="$%v" exec %v "$@"`, auth.passwordEnv, strings.Join(cmd, " "))
+	return append([]string{"sh", "-c", script, cli}, args...)
+}
+
+// redisCLI used to run a single CLI command in a redis pod and return its
+// output
+func (p *Plugin) redisCLI(ctx context.Context, sr *simplev1.Redis, pod *corev1.Pod, auth cliAuth, args ...string) (string, error) {
+	var out, errOut bytes.Buffer
+	err := p.Exec(ctx, client.ObjectKeyFromObject(pod), redisContainer, cliCommand(sr, auth, args...), Streams{
+		Out:    &out,
+		ErrOut: &errOut,
+	})
+	if err != nil {
+		return "", fmt.Errorf("running %v on %v: %w: %v", args[0], pod.Name, err, strings.TrimSpace(errOut.String()))
+	}
+	// the CLI exits zero on error replies
+	if s := out.String(); strings.HasPrefix(s, "ERR") || strings.HasPrefix(s, "NOPERM") || strings.HasPrefix(s, "WRONGPASS") {
+		return "", fmt.Errorf("running %v on %v: %v", args[0], pod.Name, strings.TrimSpace(s))
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,258 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+var _ = Describe("kubectl-redis", func() {
+	const (
+		redisName      = "redis-test"
+		redisNamespace = "default"
+	)
+
+	var (
+		ctx      context.Context
+		sr       *simplev1.Redis
+		out      *bytes.Buffer
+		commands [][]string
+		replies  map[string]string
+	)
+
+	pod := func(name, ip string, inSync bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if inSync {
+			status = corev1.ConditionTrue
+		}
+		labels := iredis.InstanceLabels(redisName)
+		labels[iredis.RoleLabel] = "master"
+		if strings.Contains(name, "-replica-") {
+			labels[iredis.RoleLabel] = "replica"
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: redisNamespace,
+				Labels:    labels,
+			},
+			Status: corev1.PodStatus{
+				PodIP: ip,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+					{Type: iredis.InSyncCondition, Status: status},
+				},
+			},
+		}
+	}
+
+	newPlugin := func(objs ...client.Object) *Plugin {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(simplev1.AddToScheme(scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+		exec := func(ctx context.Context, pod types.NamespacedName, container string, command []string, streams Streams) error {
+			commands = append(commands, command)
+			// replies are keyed by the pod name and the end of the command
+			for key, reply := range replies {
+				name, suffix, _ := strings.Cut(key, " ")
+				if name == pod.Name && strings.HasSuffix(strings.Join(command, " "), " "+suffix) {
+					fmt.Fprint(streams.Out, reply)
+					return nil
+				}
+			}
+			return fmt.Errorf("unexpected command %v", command)
+		}
+		return &Plugin{
+			Client:    c,
+			Exec:      exec,
+			Namespace: redisNamespace,
+			Streams:   Streams{Out: out, ErrOut: out},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		out = &bytes.Buffer{}
+		commands = nil
+		replies = map[string]string{}
+		sr = &simplev1.Redis{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      redisName,
+				Namespace: redisNamespace,
+			},
+			Spec: simplev1.RedisSpec{
+				ClusterSize: 3,
+				Version:     "6.2.3",
+				LogLevel:    simplev1.RLogLevelNotice,
+				Config:      map[string]string{"maxmemory": "100mb", "maxmemory-policy": "allkeys-lru"},
+			},
+			Status: simplev1.RedisStatus{
+				Status:   simplev1.StatusSuccess,
+				Master:   "redis-test-master-a",
+				Replicas: 3,
+			},
+		}
+	})
+
+	Context("when showing the status", func() {
+		It("should print the replicas under the master with their lag", func() {
+			replies["redis-test-master-a INFO replication"] = "role:master\r\nslave0:ip=10.0.0.2,port=6379,state=online,offset=42,lag=1\r\n"
+			replies["redis-test-replica-b INFO replication"] = "role:slave\r\n"
+			replies["redis-test-replica-c INFO replication"] = "role:slave\r\n"
+			p := newPlugin(sr,
+				pod("redis-test-master-a", "10.0.0.1", false),
+				pod("redis-test-replica-b", "10.0.0.2", true),
+				pod("redis-test-replica-c", "10.0.0.3", false),
+			)
+			Expect(p.Status(ctx, redisName)).To(Succeed())
+			lines := strings.Split(out.String(), "\n")
+			Expect(lines[0]).Should(ContainSubstring("redis/redis-test"))
+			Expect(lines[1]).Should(MatchRegexp(`└─ redis-test-master-a\s+master\s+10.0.0.1\s+ready`))
+			Expect(lines[2]).Should(MatchRegexp(`├─ redis-test-replica-b\s+replica\s+10.0.0.2\s+online, offset 42, lag 1s`))
+			Expect(lines[3]).Should(MatchRegexp(`└─ redis-test-replica-c\s+replica\s+10.0.0.3\s+not connected`))
+		})
+
+		It("should list the loaded modules", func() {
+			sr.Status.Modules = []simplev1.ModuleStatus{{Name: "ReJSON", Version: "2.4.7"}}
+			p := newPlugin(sr)
+			Expect(p.Status(ctx, redisName)).To(Succeed())
+			Expect(out.String()).Should(ContainSubstring("Modules:"))
+			Expect(out.String()).Should(MatchRegexp(`ReJSON\s+2.4.7`))
+		})
+	})
+
+	Context("when running redis-cli", func() {
+		It("should authenticate with the password of the container env", func() {
+			sr.Spec.Auth = &simplev1.AuthSpec{SecretName: "redis-auth"}
+			replies["redis-test-master-a DBSIZE"] = "0\n"
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			Expect(p.CLI(ctx, redisName, []string{"DBSIZE"})).To(Succeed())
+			Expect(commands).Should(Equal([][]string{
+				{"sh", "-c", `REDISCLI_AUTH="$REDIS_PASSWORD" exec redis-cli -p 6379 "$@"`, "redis-cli", "DBSIZE"},
+			}))
+		})
+
+		It("should run the CLI of the engine", func() {
+			sr.Spec.Engine = simplev1.EngineKeyDB
+			replies["redis-test-master-a DBSIZE"] = "0\n"
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			Expect(p.CLI(ctx, redisName, []string{"DBSIZE"})).To(Succeed())
+			Expect(commands[0][0]).Should(Equal("keydb-cli"))
+		})
+	})
+
+	Context("when requesting a failover", func() {
+		It("should pick an in sync replica", func() {
+			p := newPlugin(sr,
+				pod("redis-test-master-a", "10.0.0.1", false),
+				pod("redis-test-replica-b", "10.0.0.2", false),
+				pod("redis-test-replica-c", "10.0.0.3", true),
+			)
+			Expect(p.Failover(ctx, redisName, "", 0)).To(Succeed())
+			updated, err := p.get(ctx, redisName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Annotations).Should(HaveKeyWithValue(simplev1.FailoverAnnotation, "redis-test-replica-c"))
+		})
+
+		It("should only pick pods of the master deployment with role overrides", func() {
+			sr.Spec.Replicas.Config = map[string]string{"appendonly": "yes"}
+			p := newPlugin(sr,
+				pod("redis-test-master-a", "10.0.0.1", false),
+				pod("redis-test-replica-c", "10.0.0.3", true),
+			)
+			Expect(p.Failover(ctx, redisName, "", 0)).ShouldNot(Succeed())
+			err := p.Failover(ctx, redisName, "redis-test-replica-c", 0)
+			Expect(err).Should(MatchError(ContainSubstring("overrides of the replicas")))
+		})
+
+		It("should refuse the acting master as target", func() {
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			Expect(p.Failover(ctx, redisName, "redis-test-master-a", 0)).ShouldNot(Succeed())
+		})
+	})
+
+	Context("when pausing", func() {
+		It("should set spec.paused", func() {
+			p := newPlugin(sr)
+			Expect(p.SetPaused(ctx, redisName, true)).To(Succeed())
+			updated, err := p.get(ctx, redisName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Spec.Paused).Should(BeTrue())
+		})
+	})
+
+	Context("when taking a backup", func() {
+		It("should copy the dump once the save finished", func() {
+			replies["redis-test-master-a BGSAVE"] = "Background saving started\n"
+			// a save within the same second as the previous one keeps
+			// rdb_last_save_time, only the save in progress tells them apart
+			replies["redis-test-master-a INFO persistence"] = "rdb_bgsave_in_progress:0\r\nrdb_last_save_time:1700000000\r\nrdb_last_bgsave_status:ok\r\n"
+			replies["redis-test-master-a "+iredis.DumpPath] = "REDIS0009"
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			dump := &bytes.Buffer{}
+			Expect(p.Backup(ctx, redisName, dump, time.Second)).To(Succeed())
+			Expect(dump.String()).Should(Equal("REDIS0009"))
+			Expect(commands).ShouldNot(ContainElement(ContainElement("LASTSAVE")))
+		})
+
+		It("should report a failed save", func() {
+			replies["redis-test-master-a BGSAVE"] = "Background saving started\n"
+			replies["redis-test-master-a INFO persistence"] = "rdb_bgsave_in_progress:0\r\nrdb_last_bgsave_status:err\r\n"
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			err := p.Backup(ctx, redisName, &bytes.Buffer{}, time.Second)
+			Expect(err).Should(MatchError(ContainSubstring("failed with status err")))
+		})
+
+		It("should report a refused save", func() {
+			replies["redis-test-master-a BGSAVE"] = "ERR Background save already in progress\n"
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			err := p.Backup(ctx, redisName, &bytes.Buffer{}, time.Second)
+			Expect(err).Should(MatchError(ContainSubstring("already in progress")))
+		})
+	})
+
+	Context("when comparing the config", func() {
+		It("should only report directives that drifted", func() {
+			replies["redis-test-master-a GET *"] = "maxmemory\n104857600\nmaxmemory-policy\nnoeviction\nloglevel\nnotice\nport\n6379\n"
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			Expect(p.ConfigDiff(ctx, redisName)).To(Succeed())
+			Expect(out.String()).ShouldNot(ContainSubstring("maxmemory "))
+			Expect(out.String()).Should(MatchRegexp(`maxmemory-policy\s+allkeys-lru\s+noeviction`))
+			Expect(out.String()).ShouldNot(ContainSubstring("loglevel"))
+		})
+
+		It("should compare a replica acting as master with the replica overrides", func() {
+			sr.Status.Master = "redis-test-replica-b"
+			sr.Spec.Replicas.Config = map[string]string{"maxmemory-policy": "noeviction"}
+			replies["redis-test-replica-b GET *"] = "maxmemory\n104857600\nmaxmemory-policy\nnoeviction\nloglevel\nnotice\nport\n6379\n"
+			p := newPlugin(sr, pod("redis-test-replica-b", "10.0.0.2", true))
+			Expect(p.ConfigDiff(ctx, redisName)).To(Succeed())
+			Expect(out.String()).Should(ContainSubstring("redis-test-replica-b runs with the configuration"))
+		})
+
+		It("should use renamed commands", func() {
+			sr.Spec.CommandPolicy = &simplev1.CommandPolicySpec{Renamed: map[string]string{"CONFIG": "cfg"}}
+			replies["redis-test-master-a GET *"] = ""
+			p := newPlugin(sr, pod("redis-test-master-a", "10.0.0.1", false))
+			Expect(p.ConfigDiff(ctx, redisName)).To(Succeed())
+			Expect(commands[0]).Should(ContainElement("cfg"))
+			Expect(commands[0][2]).Should(Equal(`REDISCLI_AUTH="$REDIS_ADMIN_PASSWORD" exec redis-cli -p 6379 --user operator "$@"`))
+		})
+	})
+})
@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	configv1alpha1 "github.com/spazzy757/simple-redis/api/config/v1alpha1"
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	simplev2 "github.com/spazzy757/simple-redis/api/v2"
+	"github.com/spazzy757/simple-redis/controllers"
+)
+
+var renderScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(renderScheme))
+	utilruntime.Must(simplev1.AddToScheme(renderScheme))
+	utilruntime.Must(simplev2.AddToScheme(renderScheme))
+}
+
+// RenderOptions are the settings of the operator the rendered objects depend
+// on
+type RenderOptions struct {
+	// Namespace of redis instances that do not set one
+	Namespace string
+	// Defaults of the operator config applied by the defaulting webhook
+	Defaults configv1alpha1.RedisDefaults
+	// OperatorNamespace the operator runs in, admitted by the network
+	// policies
+	OperatorNamespace string
+}
+
+// Render used to print the objects the operator generates for the redis
+// instances in the v1 or v2 manifests read from in, after applying the
+// defaulting and validating webhooks. No cluster is needed
+func Render(in io.Reader, out io.Writer, opts RenderOptions) error {
+	simplev1.SetOperatorDefaults(func() configv1alpha1.RedisDefaults {
+		return opts.Defaults
+	})
+	decoder := serializer.NewCodecFactory(renderScheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(in))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		obj, gvk, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return err
+		}
+		var sr simplev1.Redis
+		switch o := obj.(type) {
+		case *simplev1.Redis:
+			sr = *o
+		case *simplev2.Redis:
+			if err := sr.ConvertFrom(o); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("expected a Redis resource, got %v", gvk.Kind)
+		}
+		if sr.Namespace == "" {
+			sr.Namespace = opts.Namespace
+		}
+		sr.Default()
+		if err := sr.ValidateCreate(); err != nil {
+			return err
+		}
+		objs, err := controllers.Render(sr, opts.Defaults, opts.OperatorNamespace)
+		if err != nil {
+			return err
+		}
+		for _, o := range objs {
+			if err := writeObject(out, o); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeObject used to print an object as a YAML document, leaving out the
+// fields only set by the API server
+func writeObject(out io.Writer, obj runtime.Object) error {
+	gvks, _, err := renderScheme.ObjectKinds(obj)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "status")
+	if meta, ok := fields["metadata"].(map[string]interface{}); ok {
+		delete(meta, "creationTimestamp")
+	}
+	data, err = yaml.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "---\n%s", data)
+	return err
+}
+
+// Diff used to print a unified diff between a previous render and the
+// current one, reporting whether they differ
+func Diff(out io.Writer, previousName string, previous, current []byte) (bool, error) {
+	if bytes.Equal(previous, current) {
+		return false, nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(previous)),
+		B:        difflib.SplitLines(string(current)),
+		FromFile: previousName,
+		ToFile:   "rendered",
+		Context:  3,
+	})
+	if err != nil {
+		return true, err
+	}
+	_, err = io.WriteString(out, diff)
+	return true, err
+}
@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("render", func() {
+	const v1Manifest = `apiVersion: simple.simple.redis/v1
+kind: Redis
+metadata:
+  name: cache
+spec:
+  clusterSize: 3
+  auth:
+    secretName: cache-auth
+`
+	const v2Manifest = `apiVersion: simple.simple.redis/v2
+kind: Redis
+metadata:
+  name: sessions
+  namespace: team
+spec:
+  clusterSize: 2
+  networkPolicy: {}
+`
+
+	render := func(manifest string) (string, error) {
+		var out bytes.Buffer
+		err := Render(strings.NewReader(manifest), &out, RenderOptions{
+			Namespace:         "default",
+			OperatorNamespace: "simple-redis-system",
+		})
+		return out.String(), err
+	}
+
+	It("should render the objects of a defaulted v1 resource", func() {
+		out, err := render(v1Manifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "kind: Deployment")).Should(Equal(2))
+		Expect(strings.Count(out, "kind: Service\n")).Should(Equal(3))
+		Expect(out).Should(ContainSubstring("name: cache-binding"))
+		Expect(out).Should(ContainSubstring("namespace: default"))
+		Expect(out).Should(ContainSubstring("--loglevel notice"))
+		Expect(out).Should(ContainSubstring("replicas: 2"))
+		Expect(out).Should(ContainSubstring("password: <generated in cluster>"))
+		Expect(out).ShouldNot(ContainSubstring("creationTimestamp: null\n  name"))
+	})
+
+	It("should convert v2 resources and render every document", func() {
+		out, err := render(v1Manifest + "---\n" + v2Manifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).Should(ContainSubstring("name: sessions-master"))
+		Expect(out).Should(ContainSubstring("namespace: team"))
+		Expect(strings.Count(out, "kind: NetworkPolicy")).Should(Equal(2))
+	})
+
+	It("should render standalone instances without replicas", func() {
+		out, err := render(strings.Replace(v1Manifest, "clusterSize: 3", "mode: standalone", 1))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "kind: Deployment")).Should(Equal(1))
+		Expect(strings.Count(out, "kind: Service\n")).Should(Equal(2))
+		Expect(out).Should(ContainSubstring("name: cache-master"))
+		Expect(out).ShouldNot(ContainSubstring("name: cache-replica"))
+	})
+
+	It("should merge the pod template into every role", func() {
+		out, err := render(v1Manifest + `  podTemplate:
+    metadata:
+      annotations:
+        vault.hashicorp.com/agent-inject: "true"
+    spec:
+      containers:
+      - name: log-shipper
+        image: fluent/fluent-bit:2.1
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "vault.hashicorp.com/agent-inject")).Should(Equal(2))
+		Expect(strings.Count(out, "name: log-shipper")).Should(Equal(2))
+	})
+
+	It("should override the spec per role", func() {
+		out, err := render(v1Manifest + `  config:
+    maxmemory: 100mb
+  replicas:
+    persistence:
+      appendOnly: true
+    config:
+      maxmemory: 200mb
+    nodeSelector:
+      disk: ssd
+    service:
+      type: LoadBalancer
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "--appendonly yes")).Should(Equal(1))
+		Expect(strings.Count(out, "--maxmemory 100mb")).Should(Equal(1))
+		Expect(strings.Count(out, "--maxmemory 200mb")).Should(Equal(1))
+		Expect(strings.Count(out, "disk: ssd")).Should(Equal(1))
+		Expect(strings.Count(out, "type: LoadBalancer")).Should(Equal(1))
+		replica := out[strings.Index(out, "name: cache-replica"):]
+		Expect(replica).Should(ContainSubstring("--appendonly yes"))
+
+		_, err = render(v1Manifest + `  replicas:
+    config:
+      notify-keyspace-events: "Ex\rrename-command CONFIG \"\""
+`)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("spec.replicas.config[notify-keyspace-events]"))
+		Expect(err.Error()).Should(ContainSubstring("must not contain control characters"))
+	})
+
+	It("should load modules copied from their images", func() {
+		out, err := render(strings.Replace(v1Manifest, "clusterSize: 3", "clusterSize: 3\n  version: 7.2.4", 1) + `  modules:
+  - name: json
+    image: redislabs/rejson:2.6.6
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "--loadmodule /modules/json.so")).Should(Equal(2))
+		Expect(strings.Count(out, "name: module-json")).Should(Equal(2))
+		Expect(out).Should(ContainSubstring("/usr/lib/redis/modules/rejson.so"))
+
+		_, err = render(v1Manifest + `  modules:
+  - name: json
+    image: redislabs/rejson:2.6.6
+`)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("json 2.6 requires redis 7.2 or later"))
+
+		_, err = render(v1Manifest + `  modules:
+  - name: bloom
+    path: /usr/lib/redis/modules/redisbloom.so
+    args: ["ERROR_RATE 0.01", "INITIAL_SIZE\n1000"]
+`)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("spec.modules[0].args[0]"))
+		Expect(err.Error()).Should(ContainSubstring("spec.modules[0].args[1]"))
+	})
+
+	It("should render the images and probes of the engine", func() {
+		out, err := render(v1Manifest + `  engine: valkey
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "image: valkey/valkey:8.0.1-alpine")).Should(Equal(2))
+		Expect(out).Should(ContainSubstring("valkey-cli -p 6379"))
+		Expect(out).ShouldNot(ContainSubstring("redis-cli"))
+
+		out, err = render(v1Manifest + `  engine: keydb
+  replicas:
+    config:
+      server-threads: "4"
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "--server-threads 4")).Should(Equal(1))
+		Expect(strings.Count(out, "image: eqalpha/keydb:v6.3.4")).Should(Equal(2))
+
+		_, err = render(v1Manifest + `  config:
+    server-threads: "4"
+`)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("server-threads is only supported by keydb"))
+	})
+
+	It("should override the probe timings", func() {
+		out, err := render(v1Manifest + `  probes:
+    startup:
+      failureThreshold: 720
+    readiness:
+      periodSeconds: 2
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(out, "startupProbe:")).Should(Equal(2))
+		Expect(strings.Count(out, "failureThreshold: 720")).Should(Equal(2))
+		Expect(strings.Count(out, "periodSeconds: 2\n")).Should(Equal(2))
+		Expect(out).Should(ContainSubstring("master_link_status:up"))
+	})
+
+	It("should reject resources the webhook rejects", func() {
+		_, err := render(strings.Replace(v1Manifest, "clusterSize: 3", "clusterSize: -1", 1))
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("spec.clusterSize"))
+	})
+
+	It("should diff against a previous render", func() {
+		previous, err := render(v1Manifest)
+		Expect(err).NotTo(HaveOccurred())
+		current, err := render(strings.Replace(v1Manifest, "clusterSize: 3", "clusterSize: 4", 1))
+		Expect(err).NotTo(HaveOccurred())
+
+		var out bytes.Buffer
+		differ, err := Diff(&out, "previous.yaml", []byte(previous), []byte(previous))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(differ).Should(BeFalse())
+
+		differ, err = Diff(&out, "previous.yaml", []byte(previous), []byte(current))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(differ).Should(BeTrue())
+		Expect(out.String()).Should(ContainSubstring("-  replicas: 2"))
+		Expect(out.String()).Should(ContainSubstring("+  replicas: 3"))
+	})
+})
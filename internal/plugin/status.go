@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	iredis "github.com/spazzy757/simple-redis/internal/redis"
+)
+
+// podInfo is a pod of the instance along with its INFO replication fields,
+// info is nil when the pod could not be queried
+type podInfo struct {
+	corev1.Pod
+	info map[string]string
+}
+
+// Status used to print the topology of a redis instance: the acting master
+// with its replicas, their replication lag and the conditions
+func (p *Plugin) Status(ctx context.Context, name string) error {
+	sr, err := p.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods, err := p.pods(ctx, sr)
+	if err != nil {
+		return err
+	}
+	auth := authFor(sr)
+	infos := make([]podInfo, 0, len(pods))
+	for i := range pods {
+		pi := podInfo{Pod: pods[i]}
+		if pods[i].Status.PodIP != "" {
+			// unreachable pods are shown without replication details
+			if out, err := p.redisCLI(ctx, sr, &pods[i], auth, "INFO", "replication"); err == nil {
+				pi.info = iredis.ParseInfo(out)
+			}
+		}
+		infos = append(infos, pi)
+	}
+	return renderStatus(p.Streams.Out, sr, infos)
+}
+
+// renderStatus used to print the topology tree of an instance
+func renderStatus(out io.Writer, sr *simplev1.Redis, pods []podInfo) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	version := sr.Status.Version
+	if version == "" {
+		version = sr.Spec.Version
+	}
+	fmt.Fprintf(w, "redis/%v\t%v\tversion %v\treplicas %v/%v\n",
+		sr.Name, sr.Status.Status, version, sr.Status.Replicas, sr.Spec.ClusterSize)
+
+	var acting *podInfo
+	for i := range pods {
+		if pods[i].Name == sr.Status.Master {
+			acting = &pods[i]
+		}
+	}
+	if acting == nil {
+		fmt.Fprintf(w, "└─ no acting master\n")
+	} else {
+		fmt.Fprintf(w, "└─ %v\tmaster\t%v\t%v\n", acting.Name, acting.Status.PodIP, podState(acting))
+		var replicas []podInfo
+		for _, p := range pods {
+			if p.Name != acting.Name {
+				replicas = append(replicas, p)
+			}
+		}
+		connected := map[string]iredis.Replica{}
+		for _, r := range iredis.ParseReplicas(acting.info) {
+			connected[r.IP] = r
+		}
+		for i, p := range replicas {
+			branch := "├─"
+			if i == len(replicas)-1 {
+				branch = "└─"
+			}
+			r, ok := connected[p.Status.PodIP]
+			if !ok || p.Status.PodIP == "" {
+				fmt.Fprintf(w, "   %v %v\treplica\t%v\tnot connected\n", branch, p.Name, p.Status.PodIP)
+				continue
+			}
+			fmt.Fprintf(w, "   %v %v\treplica\t%v\t%v, offset %v, lag %vs\n", branch, p.Name, p.Status.PodIP, r.State, r.Offset, r.Lag)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(sr.Status.Modules) > 0 {
+		fmt.Fprintln(out, "\nModules:")
+		w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, m := range sr.Status.Modules {
+			fmt.Fprintf(w, "  %v\t%v\n", m.Name, m.Version)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(sr.Status.Conditions) == 0 {
+		return nil
+	}
+	fmt.Fprintln(out, "\nConditions:")
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, c := range sr.Status.Conditions {
+		fmt.Fprintf(w, "  %v\t%v\t%v\t%v\n", c.Type, c.Status, c.Reason, c.Message)
+	}
+	return w.Flush()
+}
+
+// podState used to summarise whether a pod is ready and reachable
+func podState(p *podInfo) string {
+	switch {
+	case p.info == nil:
+		return "unreachable"
+	case !podReady(p.Pod):
+		return "not ready"
+	}
+	return "ready"
+}
+
+// podReady used to check the ready condition of a pod
+func podReady(pod corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
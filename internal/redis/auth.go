@@ -0,0 +1,35 @@
+package redis
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PasswordEnv is the environment variable holding the redis password, it
+	// can be referenced from args as $(REDIS_PASSWORD)
+	PasswordEnv = "REDIS_PASSWORD"
+	// DefaultPasswordKey is the key of the password within the auth secret
+	// when none is given
+	DefaultPasswordKey = "password"
+)
+
+// AddAuthEnv used to expose the password from the auth secret to the redis
+// container, REDISCLI_AUTH lets the CLI in the probes authenticate, the CLIs
+// of every engine read it
+func AddAuthEnv(deploy *appsv1.Deployment, secretName, secretKey string) {
+	if secretKey == "" {
+		secretKey = DefaultPasswordKey
+	}
+	source := &v1.EnvVarSource{
+		SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: secretName},
+			Key:                  secretKey,
+		},
+	}
+	container := &deploy.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env,
+		v1.EnvVar{Name: PasswordEnv, ValueFrom: source},
+		v1.EnvVar{Name: "REDISCLI_AUTH", ValueFrom: source},
+	)
+}
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// bindingType is the secret type defined by the Service Binding
+	// specification for redis
+	bindingType = "servicebinding.io/redis"
+	// bindingProvider identifies this operator as the provider of a binding
+	bindingProvider = "simple-redis"
+)
+
+// Binding holds the connection details published to applications
+type Binding struct {
+	Host     string
+	Port     int
+	Password string
+}
+
+// BindingName used to name the binding secret and config map
+func BindingName(name string) string {
+	return generateName(name, "binding")
+}
+
+// MasterHost used to get the cluster DNS name of the master service
+func MasterHost(name, ns string) string {
+	return fmt.Sprintf("%v.%v.svc", generateName(name, "master"), ns)
+}
+
+// URI used to build the redis:// connection URI for the binding
+func (b Binding) URI() string {
+	u := url.URL{
+		Scheme: "redis",
+		Host:   net.JoinHostPort(b.Host, strconv.Itoa(b.Port)),
+	}
+	if b.Password != "" {
+		u.User = url.UserPassword("default", b.Password)
+	}
+	return u.String()
+}
+
+// GenerateBindingSecret used to setup the secret holding the connection
+// details, laid out as described by the Service Binding specification so it
+// can be mounted directly by workloads
+func GenerateBindingSecret(name, ns string, b Binding) *v1.Secret {
+	data := map[string]string{
+		"type":     "redis",
+		"provider": bindingProvider,
+		"host":     b.Host,
+		"port":     strconv.Itoa(b.Port),
+		"uri":      b.URI(),
+	}
+	if b.Password != "" {
+		data["password"] = b.Password
+	}
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BindingName(name),
+			Namespace: ns,
+			Labels:    getLabels(name, "binding"),
+		},
+		Type:       bindingType,
+		StringData: data,
+	}
+}
+
+// GenerateBindingConfigMap used to setup a config map holding the non
+// sensitive connection details
+func GenerateBindingConfigMap(name, ns string, b Binding) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BindingName(name),
+			Namespace: ns,
+			Labels:    getLabels(name, "binding"),
+		},
+		Data: map[string]string{
+			"type":     "redis",
+			"provider": bindingProvider,
+			"host":     b.Host,
+			"port":     strconv.Itoa(b.Port),
+		},
+	}
+}
@@ -0,0 +1,205 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is a minimal redis client used for the management commands the
+// operator needs to run against redis instances
+type Client interface {
+	// Do sends a command and returns the decoded reply, which is one of
+	// string, int64, []interface{} or nil
+	Do(ctx context.Context, args ...string) (interface{}, error)
+	Close() error
+}
+
+// Dialer opens a client connection to the redis instance listening on addr
+type Dialer func(ctx context.Context, addr string, creds Credentials) (Client, error)
+
+// Credentials used to authenticate a connection, the default user is used
+// when no username is given
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// dialTimeout bounds connecting to an instance so an unreachable pod does not
+// block reconciliation
+const dialTimeout = 5 * time.Second
+
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+}
+
+// Dial used to connect to a redis instance, authenticating when a password is
+// given
+func Dial(ctx context.Context, addr string, creds Credentials) (Client, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	cl := &conn{c: c, r: bufio.NewReader(c)}
+	if creds.Password != "" {
+		args := []string{"AUTH", creds.Password}
+		if creds.Username != "" {
+			args = []string{"AUTH", creds.Username, creds.Password}
+		}
+		if _, err := cl.Do(ctx, args...); err != nil {
+			cl.Close()
+			return nil, err
+		}
+	}
+	return cl, nil
+}
+
+// Do implements Client
+func (c *conn) Do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dialTimeout)
+	}
+	if err := c.c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.c.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// Close implements Client
+func (c *conn) Close() error {
+	return c.c.Close()
+}
+
+// readReply used to decode a single RESP reply
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %v", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+// Info used to run INFO for the given section and parse the fields into a map
+func Info(ctx context.Context, c Client, section string) (map[string]string, error) {
+	reply, err := c.Do(ctx, "INFO", section)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected INFO reply %T", reply)
+	}
+	return ParseInfo(s), nil
+}
+
+// ParseInfo used to parse the key:value lines returned by INFO
+func ParseInfo(s string) map[string]string {
+	info := map[string]string{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			info[k] = v
+		}
+	}
+	return info
+}
+
+// ReplicaInSync used to determine from INFO replication whether a replica has
+// finished its initial sync and is connected to its master
+func ReplicaInSync(info map[string]string) bool {
+	return info["role"] == "slave" &&
+		info["master_link_status"] == "up" &&
+		info["master_sync_in_progress"] == "0"
+}
+
+// Replica is a connected replica as reported by INFO replication on its
+// master
+type Replica struct {
+	IP     string
+	Port   string
+	State  string
+	Offset int64
+	Lag    int64
+}
+
+// ParseReplicas used to read the connected replicas from the slaveN fields of
+// INFO replication, ordered as reported by the master
+func ParseReplicas(info map[string]string) []Replica {
+	var replicas []Replica
+	for i := 0; ; i++ {
+		line, ok := info[fmt.Sprintf("slave%d", i)]
+		if !ok {
+			return replicas
+		}
+		var r Replica
+		for _, field := range strings.Split(line, ",") {
+			k, v, _ := strings.Cut(field, "=")
+			switch k {
+			case "ip":
+				r.IP = v
+			case "port":
+				r.Port = v
+			case "state":
+				r.State = v
+			case "offset":
+				r.Offset, _ = strconv.ParseInt(v, 10, 64)
+			case "lag":
+				r.Lag, _ = strconv.ParseInt(v, 10, 64)
+			}
+		}
+		replicas = append(replicas, r)
+	}
+}
@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AdminUser is the ACL user the operator authenticates as once a command
+	// policy restricts the default user, replicas also sync as this user
+	AdminUser = "operator"
+	// AdminPasswordEnv is the environment variable holding the password of
+	// the admin user
+	AdminPasswordEnv = "REDIS_ADMIN_PASSWORD"
+	// adminPasswordKey is the key of the password within the admin secret
+	adminPasswordKey = "password"
+)
+
+// AdminSecretName used to get the name of the secret holding the password of
+// the admin user
+func AdminSecretName(name string) string {
+	return generateName(name, "admin")
+}
+
+// GenerateAdminSecret used to setup the secret holding the password of the
+// admin user
+func GenerateAdminSecret(name, ns, password string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      AdminSecretName(name),
+			Namespace: ns,
+			Labels:    getLabels(name, "admin"),
+		},
+		Type: v1.SecretTypeOpaque,
+		StringData: map[string]string{
+			adminPasswordKey: password,
+		},
+	}
+}
+
+// AdminPassword used to read the password of the admin user from its secret
+func AdminPassword(secret *v1.Secret) (string, error) {
+	password, ok := secret.Data[adminPasswordKey]
+	if !ok || len(password) == 0 {
+		return "", fmt.Errorf("admin secret %v has no key %v", secret.Name, adminPasswordKey)
+	}
+	return string(password), nil
+}
+
+// AddAdminEnv used to expose the password of the admin user to the redis
+// container
+func AddAdminEnv(deploy *appsv1.Deployment, name string) {
+	container := &deploy.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env, v1.EnvVar{
+		Name: AdminPasswordEnv,
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: AdminSecretName(name)},
+				Key:                  adminPasswordKey,
+			},
+		},
+	})
+}
+
+// ACLArgs used to render the users of a command policy: the default user used
+// by clients without the administrative and the disabled commands, and the
+// admin user the operator and the replicas authenticate as. Channel
+// permissions only exist since 6.2
+func ACLArgs(disabled []string, clientAuth, channels bool) []string {
+	keys := "~*"
+	if channels {
+		keys = "~* &*"
+	}
+	password := "nopass"
+	if clientAuth {
+		password = fmt.Sprintf(">$(%v)", PasswordEnv)
+	}
+	// without -@admin clients could lift the policy again with ACL SETUSER,
+	// CONFIG SET or MODULE LOAD
+	client := fmt.Sprintf("--user default on %v %v +@all -@admin", password, keys)
+	for _, command := range disabled {
+		client += " -" + strings.ToLower(command)
+	}
+	return []string{
+		client,
+		fmt.Sprintf("--user %v on >$(%v) %v +@all", AdminUser, AdminPasswordEnv, keys),
+		fmt.Sprintf("--masteruser %v", AdminUser),
+		fmt.Sprintf("--masterauth $(%v)", AdminPasswordEnv),
+	}
+}
+
+// RenameArgs used to render the renamed commands, sorted so the generated
+// deployment does not change between reconciles
+func RenameArgs(renamed map[string]string) []string {
+	commands := make([]string, 0, len(renamed))
+	targets := make(map[string]string, len(renamed))
+	for command, target := range renamed {
+		command = strings.ToLower(command)
+		commands = append(commands, command)
+		targets[command] = target
+	}
+	sort.Strings(commands)
+	args := make([]string, 0, len(commands))
+	for _, command := range commands {
+		args = append(args, fmt.Sprintf("--rename-command %v %v", command, targets[command]))
+	}
+	return args
+}
@@ -0,0 +1,162 @@
+package redis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// SpecHashAnnotation holds the hash of the desired state an object was last
+// written with by the operator
+const SpecHashAnnotation = "simple.simple.redis/spec-hash"
+
+// Object is a generated object, typed objects of client-go satisfy it
+type Object interface {
+	metav1.Object
+	runtime.Object
+}
+
+// SpecHash used to hash the desired state of a generated object, leaving out
+// the hash annotation itself
+func SpecHash(obj Object) (string, error) {
+	fields, err := desiredFields(obj)
+	if err != nil {
+		return "", err
+	}
+	// maps are marshalled with sorted keys, so equal objects hash equally
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// SetSpecHash used to stamp a generated object with the hash of its desired
+// state
+func SetSpecHash(obj Object) error {
+	hash, err := SpecHash(obj)
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SpecHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// Drift used to list the fields of the desired object whose live value
+// differs. Fields the desired object leaves empty and fields only set on the
+// live object, like the ones defaulted by the API server, are not compared
+func Drift(desired, live Object) ([]string, error) {
+	want, err := desiredFields(desired)
+	if err != nil {
+		return nil, err
+	}
+	have, err := desiredFields(live)
+	if err != nil {
+		return nil, err
+	}
+	var drifted []string
+	diffFields("", want, have, &drifted)
+	sort.Strings(drifted)
+	return drifted, nil
+}
+
+// desiredFields used to get the fields making up the desired state of an
+// object: its labels, annotations other than the spec hash and everything
+// besides the metadata and status
+func desiredFields(obj Object) (map[string]interface{}, error) {
+	if secret, ok := obj.(*v1.Secret); ok && len(secret.StringData) > 0 {
+		// the API server moves string data into data on write
+		secret = secret.DeepCopy()
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for k, v := range secret.StringData {
+			secret.Data[k] = []byte(v)
+		}
+		secret.StringData = nil
+		obj = secret
+	}
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("converting %v: %w", obj.GetName(), err)
+	}
+	delete(fields, "status")
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+	meta := map[string]interface{}{}
+	if labels := obj.GetLabels(); len(labels) > 0 {
+		meta["labels"] = toInterfaceMap(labels)
+	}
+	annotations := toInterfaceMap(obj.GetAnnotations())
+	delete(annotations, SpecHashAnnotation)
+	if len(annotations) > 0 {
+		meta["annotations"] = annotations
+	}
+	fields["metadata"] = meta
+	return fields, nil
+}
+
+// toInterfaceMap used to convert a string map to the unstructured form
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// diffFields used to collect the paths below path where the live value does
+// not match the desired one
+func diffFields(path string, want, have interface{}, drifted *[]string) {
+	switch w := want.(type) {
+	case nil:
+		return
+	case map[string]interface{}:
+		h, ok := have.(map[string]interface{})
+		if !ok {
+			if len(w) > 0 {
+				*drifted = append(*drifted, path)
+			}
+			return
+		}
+		for k, v := range w {
+			diffFields(join(path, k), v, h[k], drifted)
+		}
+	case []interface{}:
+		h, ok := have.([]interface{})
+		if !ok || len(h) != len(w) {
+			if len(w) > 0 || len(h) > 0 {
+				*drifted = append(*drifted, path)
+			}
+			return
+		}
+		for i := range w {
+			diffFields(fmt.Sprintf("%v[%v]", path, i), w[i], h[i], drifted)
+		}
+	default:
+		if !reflect.DeepEqual(want, have) {
+			*drifted = append(*drifted, path)
+		}
+	}
+}
+
+// join used to append a field name to a path
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("redis drift detection", func() {
+
+	Context("when hashing the desired state", func() {
+
+		It("should hash equal objects equally", func() {
+			a := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			b := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			Expect(SetSpecHash(a)).Should(Succeed())
+			Expect(SetSpecHash(b)).Should(Succeed())
+			Expect(a.Annotations[SpecHashAnnotation]).ShouldNot(BeEmpty())
+			Expect(a.Annotations[SpecHashAnnotation]).Should(Equal(b.Annotations[SpecHashAnnotation]))
+		})
+
+		It("should change the hash with the spec", func() {
+			a := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			b := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.2.0"), 1, 6379, nil)
+			Expect(SetSpecHash(a)).Should(Succeed())
+			Expect(SetSpecHash(b)).Should(Succeed())
+			Expect(a.Annotations[SpecHashAnnotation]).ShouldNot(Equal(b.Annotations[SpecHashAnnotation]))
+		})
+
+		It("should not hash its own annotation", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			Expect(SetSpecHash(deploy)).Should(Succeed())
+			hash := deploy.Annotations[SpecHashAnnotation]
+			Expect(SetSpecHash(deploy)).Should(Succeed())
+			Expect(deploy.Annotations[SpecHashAnnotation]).Should(Equal(hash))
+		})
+	})
+
+	Context("when comparing with the live object", func() {
+
+		It("should ignore fields defaulted by the API server", func() {
+			desired := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			live := desired.DeepCopy()
+			live.ResourceVersion = "42"
+			live.Annotations = map[string]string{"deployment.kubernetes.io/revision": "3"}
+			live.Spec.Template.Spec.Containers[0].TerminationMessagePath = v1.TerminationMessagePathDefault
+			live.Spec.Template.Spec.DNSPolicy = v1.DNSClusterFirst
+			live.Status.ReadyReplicas = 1
+			drift, err := Drift(desired, live)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(drift).Should(BeEmpty())
+		})
+
+		It("should name the fields changed out-of-band", func() {
+			desired := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			live := desired.DeepCopy()
+			replicas := int32(3)
+			live.Spec.Replicas = &replicas
+			live.Spec.Template.Spec.Containers[0].Image = "redis:latest"
+			live.Labels[RoleLabel] = "replica"
+			drift, err := Drift(desired, live)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(drift).Should(Equal([]string{
+				"metadata.labels." + RoleLabel,
+				"spec.replicas",
+				"spec.template.spec.containers[0].image",
+			}))
+		})
+
+		It("should report removed list entries", func() {
+			desired := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			desired.Spec.Template.Spec.Containers[0].Resources.Limits = v1.ResourceList{
+				v1.ResourceMemory: resource.MustParse("1Gi"),
+			}
+			live := desired.DeepCopy()
+			live.Spec.Template.Spec.Containers[0].Resources.Limits = nil
+			live.Spec.Template.Spec.Volumes = nil
+			drift, err := Drift(desired, live)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(drift).Should(ConsistOf(
+				"spec.template.spec.containers[0].resources.limits",
+				"spec.template.spec.volumes",
+			))
+		})
+
+		It("should compare secret string data with the stored data", func() {
+			desired := GenerateBindingSecret("redis-test", "default", Binding{Host: "redis", Port: 6379, Password: "secret"})
+			live := desired.DeepCopy()
+			live.Data = map[string][]byte{}
+			for k, v := range live.StringData {
+				live.Data[k] = []byte(v)
+			}
+			live.StringData = nil
+			drift, err := Drift(desired, live)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(drift).Should(BeEmpty())
+
+			live.Data["password"] = []byte("changed")
+			drift, err = Drift(desired, live)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(drift).Should(Equal([]string{"data.password"}))
+		})
+	})
+})
@@ -0,0 +1,69 @@
+package redis
+
+import "fmt"
+
+// Engine is a redis compatible server, the images it is published in and the
+// binaries they ship
+type Engine struct {
+	// Name of the engine as set in spec.engine
+	Name string
+	// Repository the engine is pulled from when none is given
+	Repository string
+	// Tag is the format of the image tag of a version
+	Tag string
+	// CLI is the command line client used by the probes and the plugin
+	CLI string
+	// CheckRDB is the tool verifying an RDB file before it is restored
+	CheckRDB string
+}
+
+var (
+	// RedisEngine is redis as published in the official images
+	RedisEngine = Engine{
+		Name:       "redis",
+		Repository: DefaultImageRepository,
+		Tag:        "%v-alpine",
+		CLI:        "redis-cli",
+		CheckRDB:   "redis-check-rdb",
+	}
+	// ValkeyEngine is the valkey fork of redis
+	ValkeyEngine = Engine{
+		Name:       "valkey",
+		Repository: "valkey/valkey",
+		Tag:        "%v-alpine",
+		CLI:        "valkey-cli",
+		CheckRDB:   "valkey-check-rdb",
+	}
+	// KeyDBEngine is the multithreaded KeyDB fork of redis
+	KeyDBEngine = Engine{
+		Name:       "keydb",
+		Repository: "eqalpha/keydb",
+		Tag:        "v%v",
+		CLI:        "keydb-cli",
+		CheckRDB:   "keydb-check-rdb",
+	}
+)
+
+// engines are the supported engines by name
+var engines = map[string]Engine{
+	RedisEngine.Name:  RedisEngine,
+	ValkeyEngine.Name: ValkeyEngine,
+	KeyDBEngine.Name:  KeyDBEngine,
+}
+
+// EngineFor used to look up an engine by name, falling back to redis for
+// instances created before the engine could be chosen
+func EngineFor(name string) Engine {
+	if e, ok := engines[name]; ok {
+		return e
+	}
+	return RedisEngine
+}
+
+// Image used to get the image of a version of the engine from a repository
+func (e Engine) Image(repository, version string) string {
+	if repository == "" {
+		repository = e.Repository
+	}
+	return fmt.Sprintf("%v:"+e.Tag, repository, version)
+}
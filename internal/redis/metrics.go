@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ExporterContainerName is the name of the metrics exporter sidecar
+	ExporterContainerName = "metrics"
+	// DefaultExporterImage is the redis_exporter image used when none is
+	// given
+	DefaultExporterImage = "oliver006/redis_exporter:v1.50.0-alpine"
+	// ExporterPort is the port the exporter serves prometheus metrics on
+	ExporterPort = 9121
+)
+
+// AddExporterSidecar used to add a redis_exporter container scraping the
+// local redis instance, the credentials are shared with the redis container
+func AddExporterSidecar(deploy *appsv1.Deployment, image string, port int) {
+	if image == "" {
+		image = DefaultExporterImage
+	}
+	podSpec := &deploy.Spec.Template.Spec
+	container := v1.Container{
+		Name:  ExporterContainerName,
+		Image: image,
+		Env: []v1.EnvVar{
+			{Name: "REDIS_ADDR", Value: fmt.Sprintf("redis://localhost:%v", port)},
+		},
+		Ports: []v1.ContainerPort{
+			{
+				Name:          ExporterContainerName,
+				ContainerPort: ExporterPort,
+			},
+		},
+	}
+	var password, admin *v1.EnvVar
+	for i, env := range podSpec.Containers[0].Env {
+		switch env.Name {
+		case PasswordEnv:
+			password = &podSpec.Containers[0].Env[i]
+		case AdminPasswordEnv:
+			admin = &podSpec.Containers[0].Env[i]
+		}
+	}
+	// the admin user is preferred as a command policy may disable commands
+	// the exporter runs for the default user
+	switch {
+	case admin != nil:
+		container.Env = append(container.Env,
+			v1.EnvVar{Name: "REDIS_USER", Value: AdminUser},
+			v1.EnvVar{Name: PasswordEnv, ValueFrom: admin.ValueFrom},
+		)
+	case password != nil:
+		container.Env = append(container.Env, *password)
+	}
+	podSpec.Containers = append(podSpec.Containers, container)
+}
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// modulesVolume holds the modules copied from their images, shared
+	// between the init containers and the redis container
+	modulesVolume = "modules"
+	modulesDir    = "/modules"
+	// moduleContainerPrefix prefixes the init containers copying a module
+	moduleContainerPrefix = "module-"
+)
+
+// Module is a module redis loads on startup
+type Module struct {
+	// Name of the module, used to name the file and init container it is
+	// copied with
+	Name string
+	// Path of the shared object, within Image when one is given
+	Path string
+	// Image the module is copied from, it is loaded from the redis image
+	// when empty
+	Image string
+	// Args passed to the module when it is loaded
+	Args []string
+}
+
+// loadPath used to get the path redis loads a module from
+func (m Module) loadPath() string {
+	if m.Image == "" {
+		return m.Path
+	}
+	return path.Join(modulesDir, m.Name+".so")
+}
+
+// ModuleArgs used to render the loadmodule directives of the modules
+func ModuleArgs(modules []Module) []string {
+	args := make([]string, 0, len(modules))
+	for _, m := range modules {
+		args = append(args, strings.Join(append([]string{"--loadmodule", m.loadPath()}, m.Args...), " "))
+	}
+	return args
+}
+
+// AddModules used to copy the modules shipped in an image into the modules
+// volume with an init container per module, the redis container loads them
+// from there
+func AddModules(deploy *appsv1.Deployment, modules []Module) {
+	podSpec := &deploy.Spec.Template.Spec
+	mount := v1.VolumeMount{
+		Name:      modulesVolume,
+		MountPath: modulesDir,
+	}
+	copied := false
+	for _, m := range modules {
+		if m.Image == "" {
+			continue
+		}
+		copied = true
+		podSpec.InitContainers = append(podSpec.InitContainers, v1.Container{
+			Name:         moduleContainerPrefix + m.Name,
+			Image:        m.Image,
+			Command:      []string{"cp", m.Path, m.loadPath()},
+			VolumeMounts: []v1.VolumeMount{mount},
+		})
+	}
+	if !copied {
+		return
+	}
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, mount)
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: modulesVolume,
+		VolumeSource: v1.VolumeSource{
+			EmptyDir: &v1.EmptyDirVolumeSource{},
+		},
+	})
+}
+
+// LoadedModule is a module as reported by MODULE LIST
+type LoadedModule struct {
+	Name    string
+	Version string
+}
+
+// ModuleList used to run MODULE LIST, ordered by module name
+func ModuleList(ctx context.Context, c Client) ([]LoadedModule, error) {
+	reply, err := c.Do(ctx, "MODULE", "LIST")
+	if err != nil {
+		return nil, err
+	}
+	return ParseModuleList(reply)
+}
+
+// ParseModuleList used to read the name and version of the modules from the
+// reply of MODULE LIST, a list of field and value pairs per module
+func ParseModuleList(reply interface{}) ([]LoadedModule, error) {
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected MODULE LIST reply %T", reply)
+	}
+	loaded := make([]LoadedModule, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected MODULE LIST entry %T", item)
+		}
+		var m LoadedModule
+		for i := 0; i+1 < len(fields); i += 2 {
+			switch fields[i] {
+			case "name":
+				m.Name = fmt.Sprint(fields[i+1])
+			case "ver":
+				m.Version = moduleVersion(fields[i+1])
+			}
+		}
+		loaded = append(loaded, m)
+	}
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Name < loaded[j].Name
+	})
+	return loaded, nil
+}
+
+// moduleVersion used to format the version modules report as a single
+// integer, 20407 being 2.4.7
+func moduleVersion(ver interface{}) string {
+	v, ok := ver.(int64)
+	if !ok {
+		return fmt.Sprint(ver)
+	}
+	return fmt.Sprintf("%d.%d.%d", v/10000, v/100%100, v%100)
+}
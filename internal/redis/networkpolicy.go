@@ -0,0 +1,73 @@
+package redis
+
+import (
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// NamespaceNameLabel is set on every namespace by kubernetes, it is used to
+// select a namespace by name
+const NamespaceNameLabel = "kubernetes.io/metadata.name"
+
+// GenerateNetworkPolicy used to generate a network policy allowing the given
+// peers to reach a port of the pods of the redis instance. Once a policy
+// selects the pods any traffic no policy allows is refused
+func GenerateNetworkPolicy(name, ns, role string, port int, from []networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicy {
+	tcp := v1.ProtocolTCP
+	target := intstr.FromInt(port)
+	rules := []networkingv1.NetworkPolicyIngressRule{}
+	if len(from) > 0 {
+		// a rule without peers allows every source, so none is added
+		rules = append(rules, networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &tcp,
+					Port:     &target,
+				},
+			},
+			From: from,
+		})
+	}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateName(name, role),
+			Namespace: ns,
+			Labels:    getLabels(name, role),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: InstanceLabels(name),
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     rules,
+		},
+	}
+}
+
+// ReplicationPeers used to select the master and replica pods of the redis
+// instance, they replicate from each other and take over the master role
+func ReplicationPeers(name string) []networkingv1.NetworkPolicyPeer {
+	return []networkingv1.NetworkPolicyPeer{
+		{
+			PodSelector: &metav1.LabelSelector{MatchLabels: getLabels(name, "master")},
+		},
+		{
+			PodSelector: &metav1.LabelSelector{MatchLabels: getLabels(name, "replica")},
+		},
+	}
+}
+
+// NamespacePeer used to select pods of another namespace by name, every pod
+// of the namespace is selected when podLabels is empty
+func NamespacePeer(ns string, podLabels map[string]string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{NamespaceNameLabel: ns},
+		},
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: podLabels,
+		},
+	}
+}
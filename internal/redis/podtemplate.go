@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"encoding/json"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// MergePodTemplate used to merge a partial pod template over the pod template
+// of a deployment with a strategic merge patch, containers, volumes and env
+// vars are merged by name
+func MergePodTemplate(deploy *appsv1.Deployment, override *v1.PodTemplateSpec) error {
+	if override == nil {
+		return nil
+	}
+	original, err := json.Marshal(deploy.Spec.Template)
+	if err != nil {
+		return err
+	}
+	patch, err := partialJSON(override)
+	if err != nil {
+		return err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, v1.PodTemplateSpec{})
+	if err != nil {
+		return err
+	}
+	var template v1.PodTemplateSpec
+	if err := json.Unmarshal(merged, &template); err != nil {
+		return err
+	}
+	// the merge puts added containers first, the generated ones keep their
+	// place so the redis container stays first and the restore runs before
+	// any added init container
+	keepOrder(template.Spec.Containers, deploy.Spec.Template.Spec.Containers)
+	keepOrder(template.Spec.InitContainers, deploy.Spec.Template.Spec.InitContainers)
+	deploy.Spec.Template = template
+	return nil
+}
+
+// keepOrder used to sort merged containers in the order of the generated
+// ones, followed by the added ones in the order they were given
+func keepOrder(merged, generated []v1.Container) {
+	index := make(map[string]int, len(generated))
+	for i, c := range generated {
+		index[c.Name] = i
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, aok := index[merged[i].Name]
+		b, bok := index[merged[j].Name]
+		if aok && bok {
+			return a < b
+		}
+		return aok && !bok
+	})
+}
+
+// partialJSON used to marshal a partial object as a patch. Unset fields that
+// are not omitted, like the containers of a pod spec, marshal to null which
+// would delete them when patching, so nulls are left out
+func partialJSON(obj interface{}) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(dropNulls(fields))
+}
+
+// dropNulls used to remove the null values of an unmarshalled object
+func dropNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if field == nil {
+				delete(v, k)
+				continue
+			}
+			v[k] = dropNulls(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = dropNulls(v[i])
+		}
+	}
+	return value
+}
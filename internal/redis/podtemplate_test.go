@@ -0,0 +1,67 @@
+package redis
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("redis pod template", func() {
+
+	Context("when merging a partial pod template", func() {
+
+		It("should add sidecars, volumes and annotations", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, []string{"--port 6379"})
+			Expect(MergePodTemplate(deploy, &v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"vault.hashicorp.com/agent-inject": "true"},
+					Labels:      map[string]string{"team": "payments"},
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{Name: "log-shipper", Image: "fluent/fluent-bit:2.1"},
+					},
+					Volumes: []v1.Volume{
+						{Name: "shipper-config", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+					},
+				},
+			})).Should(Succeed())
+
+			template := deploy.Spec.Template
+			Expect(template.Annotations).Should(HaveKeyWithValue("vault.hashicorp.com/agent-inject", "true"))
+			Expect(template.Labels).Should(HaveKeyWithValue("team", "payments"))
+			Expect(template.Labels).Should(HaveKeyWithValue(RoleLabel, "master"))
+			Expect(template.Spec.Containers).Should(HaveLen(2))
+			Expect(template.Spec.Containers[0].Args).Should(Equal([]string{"--port 6379"}))
+			Expect(template.Spec.Containers).Should(ContainElement(HaveField("Name", "log-shipper")))
+			Expect(template.Spec.Volumes).Should(ContainElement(HaveField("Name", "shipper-config")))
+			Expect(template.Spec.Volumes).Should(ContainElement(HaveField("Name", dataVolume)))
+		})
+
+		It("should merge env vars into the redis container by name", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			AddAuthEnv(deploy, "redis-auth", "")
+			Expect(MergePodTemplate(deploy, &v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{Name: "redis", Env: []v1.EnvVar{{Name: "TZ", Value: "UTC"}}},
+					},
+				},
+			})).Should(Succeed())
+
+			container := deploy.Spec.Template.Spec.Containers[0]
+			Expect(deploy.Spec.Template.Spec.Containers).Should(HaveLen(1))
+			Expect(container.Image).Should(Equal(RedisEngine.Image("", "7.0.11")))
+			Expect(container.Env).Should(ContainElement(v1.EnvVar{Name: "TZ", Value: "UTC"}))
+			Expect(container.Env).Should(ContainElement(HaveField("Name", PasswordEnv)))
+		})
+
+		It("should leave the template alone without overrides", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			expected := deploy.DeepCopy()
+			Expect(MergePodTemplate(deploy, nil)).Should(Succeed())
+			Expect(deploy).Should(Equal(expected))
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ProbeKind is the probe of the redis container a check is run for
+type ProbeKind string
+
+const (
+	// ProbeStartup passes once the dataset is loaded, holding off the
+	// liveness probe during long RDB or AOF loads
+	ProbeStartup ProbeKind = "startup"
+	// ProbeLiveness passes while redis answers, loading a dataset included
+	ProbeLiveness ProbeKind = "liveness"
+	// ProbeReadiness passes once redis answers and, on replicas, the link to
+	// the master is up and the sync finished
+	ProbeReadiness ProbeKind = "readiness"
+)
+
+// ProbeTimings are the timings of a probe, zero values keep the defaults
+type ProbeTimings struct {
+	InitialDelaySeconds int32
+	PeriodSeconds       int32
+	TimeoutSeconds      int32
+	FailureThreshold    int32
+}
+
+// probeDefaults are the timings of the probes, the startup probe allows half
+// an hour for loading the dataset
+var probeDefaults = map[ProbeKind]ProbeTimings{
+	ProbeStartup:   {PeriodSeconds: 5, TimeoutSeconds: 5, FailureThreshold: 360},
+	ProbeLiveness:  {PeriodSeconds: 10, TimeoutSeconds: 5, FailureThreshold: 3},
+	ProbeReadiness: {PeriodSeconds: 5, TimeoutSeconds: 5, FailureThreshold: 3},
+}
+
+// probeScript checks the instance for the probe passed as $1 with the CLI of
+// the engine, authenticating as the admin user when there is one as the
+// command policy may have disabled INFO for the default user
+const probeScript = `cli() {
+  if [ -n "$%[3]v" ]; then
+    REDISCLI_AUTH="$%[3]v" %[1]v -p %[2]v --user %[4]v "$@"
+  else
+    %[1]v -p %[2]v "$@"
+  fi
+}
+reply=$(cli ping 2>&1)
+case "$1:$reply" in
+  *:PONG) ;;
+  liveness:LOADING*) exit 0 ;;
+  *) echo "$reply"; exit 1 ;;
+esac
+[ "$1" = readiness ] || exit 0
+info=$(cli info replication | tr -d '\r')
+case "$info" in
+  *role:slave*)
+    if ! echo "$info" | grep -q '^master_link_status:up$'; then
+      echo "link to the master is down"; exit 1
+    fi
+    if ! echo "$info" | grep -q '^master_sync_in_progress:0$'; then
+      echo "sync with the master in progress"; exit 1
+    fi
+    ;;
+esac
+`
+
+// probe used to generate a probe of the redis container
+func probe(engine Engine, port int, kind ProbeKind) *v1.Probe {
+	script := fmt.Sprintf(probeScript, engine.CLI, strconv.Itoa(port), AdminPasswordEnv, AdminUser)
+	p := &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{
+			Exec: &v1.ExecAction{
+				Command: []string{"sh", "-c", script, "probe", string(kind)},
+			},
+		},
+	}
+	setTimings(p, probeDefaults[kind])
+	return p
+}
+
+// SetProbeTimings used to override the timings of a probe of the redis
+// container
+func SetProbeTimings(deploy *appsv1.Deployment, kind ProbeKind, timings ProbeTimings) {
+	container := &deploy.Spec.Template.Spec.Containers[0]
+	switch kind {
+	case ProbeStartup:
+		setTimings(container.StartupProbe, timings)
+	case ProbeLiveness:
+		setTimings(container.LivenessProbe, timings)
+	case ProbeReadiness:
+		setTimings(container.ReadinessProbe, timings)
+	}
+}
+
+// setTimings used to set the non zero timings on a probe
+func setTimings(p *v1.Probe, timings ProbeTimings) {
+	if timings.InitialDelaySeconds != 0 {
+		p.InitialDelaySeconds = timings.InitialDelaySeconds
+	}
+	if timings.PeriodSeconds != 0 {
+		p.PeriodSeconds = timings.PeriodSeconds
+	}
+	if timings.TimeoutSeconds != 0 {
+		p.TimeoutSeconds = timings.TimeoutSeconds
+	}
+	if timings.FailureThreshold != 0 {
+		p.FailureThreshold = timings.FailureThreshold
+	}
+}
@@ -0,0 +1,46 @@
+package redis
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("probes", func() {
+
+	// run used to run a probe against a fake CLI answering PING and INFO
+	// replication with the given replies
+	run := func(kind ProbeKind, ping, info string) error {
+		dir := GinkgoT().TempDir()
+		cli := "#!/bin/sh\nfor a; do :; done\ncase \"$a\" in\n  ping) printf '%s\\n' \"$PING\" ;;\n  replication) printf '%s' \"$INFO\" ;;\nesac\n"
+		Expect(os.WriteFile(filepath.Join(dir, "redis-cli"), []byte(cli), 0o755)).To(Succeed())
+		p := probe(RedisEngine, 6379, kind)
+		cmd := exec.Command(p.Exec.Command[0], p.Exec.Command[1:]...)
+		cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"), "PING="+ping, "INFO="+info)
+		return cmd.Run()
+	}
+
+	It("should only pass the startup probe once the dataset is loaded", func() {
+		Expect(run(ProbeStartup, "LOADING Redis is loading the dataset in memory", "")).ShouldNot(Succeed())
+		Expect(run(ProbeStartup, "PONG", "")).Should(Succeed())
+		Expect(run(ProbeLiveness, "LOADING Redis is loading the dataset in memory", "")).Should(Succeed())
+	})
+
+	It("should only mark replicas ready with the link to the master up", func() {
+		Expect(run(ProbeReadiness, "PONG", "# Replication\r\nrole:master\r\nconnected_slaves:0\r\n")).Should(Succeed())
+		Expect(run(ProbeReadiness, "PONG", "# Replication\r\nrole:slave\r\nmaster_link_status:down\r\nmaster_sync_in_progress:0\r\n")).ShouldNot(Succeed())
+		Expect(run(ProbeReadiness, "PONG", "# Replication\r\nrole:slave\r\nmaster_link_status:up\r\nmaster_sync_in_progress:1\r\n")).ShouldNot(Succeed())
+		Expect(run(ProbeReadiness, "LOADING Redis is loading the dataset in memory", "")).ShouldNot(Succeed())
+	})
+
+	It("should override the timings that are set", func() {
+		deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.2.4"), 1, 6379, nil)
+		SetProbeTimings(deploy, ProbeStartup, ProbeTimings{FailureThreshold: 720})
+		startup := deploy.Spec.Template.Spec.Containers[0].StartupProbe
+		Expect(startup.FailureThreshold).Should(Equal(int32(720)))
+		Expect(startup.PeriodSeconds).Should(Equal(int32(5)))
+	})
+})
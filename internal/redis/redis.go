@@ -9,8 +9,40 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+const (
+	// NameLabel is the label holding the name of the redis instance
+	NameLabel = "simple.simple.redis/name"
+	// RoleLabel is the label holding the role of a redis pod
+	RoleLabel = "simple.simple.redis/role"
+	// MasterLabel is set by the operator on the pod currently acting as
+	// master, it is not part of any pod template so the master role can move
+	// between pods without rolling a deployment
+	MasterLabel = "simple.simple.redis/master"
+
+	// InSyncCondition is the pod readiness gate set by the operator once a
+	// replica finished syncing from its master
+	InSyncCondition v1.PodConditionType = "simple.simple.redis/in-sync"
+
+	// DefaultPort is the port redis listens on when none is configured
+	DefaultPort = 6379
+
+	// dataVolume is the volume holding the redis working directory
+	dataVolume = "data"
+	// dataDir is the working directory of the redis image, dump.rdb is
+	// read from and written to it
+	dataDir = "/data"
+	// DumpPath is the path of the RDB snapshot within the redis container
+	DumpPath = dataDir + "/dump.rdb"
+)
+
 // GenerateRedisSvc used to setup the service resource
-func GenerateRedisSvc(name, ns, role string) *v1.Service {
+func GenerateRedisSvc(name, ns, role string, port int) *v1.Service {
+	selector := getLabels(name, role)
+	if role == "master" {
+		// the master service follows the pod acting as master rather than
+		// the master deployment, so it keeps working after a failover
+		selector = MasterSelector(name)
+	}
 	return &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      generateName(name, role),
@@ -18,21 +50,69 @@ func GenerateRedisSvc(name, ns, role string) *v1.Service {
 			Labels:    getLabels(name, role),
 		},
 		Spec: v1.ServiceSpec{
-			Selector: getLabels(name, role),
+			Selector: selector,
 			Ports: []v1.ServicePort{
 				{
 					Name:       "redis",
 					Protocol:   v1.ProtocolTCP,
 					TargetPort: intstr.FromString("redis"),
-					Port:       6392,
+					Port:       int32(port),
 				},
 			},
 		},
 	}
 }
 
-// GenerateRedisDeploy used to setup the deployment resource
-func GenerateRedisDeploy(name, ns, role string, replicas int, args []string) *appsv1.Deployment {
+// GenerateHeadlessSvc used to setup a headless service selecting every pod of
+// the redis instance, giving each pod its own DNS record
+func GenerateHeadlessSvc(name, ns string, port int) *v1.Service {
+	svc := GenerateRedisSvc(name, ns, "headless", port)
+	svc.Spec.Selector = InstanceLabels(name)
+	svc.Spec.ClusterIP = v1.ClusterIPNone
+	svc.Spec.PublishNotReadyAddresses = true
+	return svc
+}
+
+// DefaultImageRepository is the repository redis is pulled from when none is
+// given
+const DefaultImageRepository = "redis"
+
+// GateOnSync used to only count pods of the deployment as ready once the
+// operator marked them in sync with their master
+func GateOnSync(deploy *appsv1.Deployment) {
+	deploy.Spec.Template.Spec.ReadinessGates = []v1.PodReadinessGate{
+		{ConditionType: InSyncCondition},
+	}
+}
+
+// OneAtATime used to replace the pods of a deployment one at a time, combined
+// with GateOnSync a rolling update waits for every new replica to resync before
+// the next one is replaced
+func OneAtATime(deploy *appsv1.Deployment) {
+	maxSurge := intstr.FromInt(0)
+	maxUnavailable := intstr.FromInt(1)
+	deploy.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+}
+
+// ExposeSvc used to set the service type, annotations and external traffic
+// policy of a service
+func ExposeSvc(svc *v1.Service, svcType v1.ServiceType, annotations map[string]string, policy v1.ServiceExternalTrafficPolicyType) {
+	if svcType != "" {
+		svc.Spec.Type = svcType
+	}
+	svc.Annotations = annotations
+	svc.Spec.ExternalTrafficPolicy = policy
+}
+
+// GenerateRedisDeploy used to setup the deployment resource, the probes use
+// the CLI of the engine
+func GenerateRedisDeploy(name, ns, role string, engine Engine, image string, replicas, port int, args []string) *appsv1.Deployment {
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      generateName(name, role),
@@ -49,59 +129,91 @@ func GenerateRedisDeploy(name, ns, role string, replicas int, args []string) *ap
 					Labels: getLabels(name, role),
 				},
 				Spec: v1.PodSpec{
+					// the headless service publishes a DNS name per pod
+					Subdomain: generateName(name, "headless"),
 					Containers: []v1.Container{
 						{
-							Name: "redis",
-							//TODO Make this configurable
-							Image: "redis:6.2.3-alpine",
-							Args:  args,
+							Name:            "redis",
+							Image:           image,
+							Args:            args,
+							SecurityContext: DefaultContainerSecurityContext(),
+							VolumeMounts: []v1.VolumeMount{
+								{
+									Name:      dataVolume,
+									MountPath: dataDir,
+								},
+								{
+									Name:      tmpVolume,
+									MountPath: tmpDir,
+								},
+							},
 							Ports: []v1.ContainerPort{
 								{
 									Name:          "redis",
-									ContainerPort: 6392,
+									ContainerPort: int32(port),
 									Protocol:      v1.ProtocolTCP,
 								},
 							},
-							LivenessProbe: &v1.Probe{
-								InitialDelaySeconds: 30,
-								TimeoutSeconds:      5,
-								ProbeHandler: v1.ProbeHandler{
-									Exec: &v1.ExecAction{
-										Command: []string{
-											"redis-cli",
-											"ping",
-										},
-									},
-								},
+							StartupProbe:   probe(engine, port, ProbeStartup),
+							LivenessProbe:  probe(engine, port, ProbeLiveness),
+							ReadinessProbe: probe(engine, port, ProbeReadiness),
+						},
+					},
+					Volumes: []v1.Volume{
+						{
+							Name: dataVolume,
+							VolumeSource: v1.VolumeSource{
+								EmptyDir: &v1.EmptyDirVolumeSource{},
 							},
-							ReadinessProbe: &v1.Probe{
-								InitialDelaySeconds: 30,
-								TimeoutSeconds:      5,
-								ProbeHandler: v1.ProbeHandler{
-									Exec: &v1.ExecAction{
-										Command: []string{
-											"redis-cli",
-											"ping",
-										},
-									},
-								},
+						},
+						{
+							Name: tmpVolume,
+							VolumeSource: v1.VolumeSource{
+								EmptyDir: &v1.EmptyDirVolumeSource{},
 							},
 						},
 					},
+					SecurityContext: DefaultPodSecurityContext(),
 				},
 			},
 		},
 	}
 }
 
+// ResourceName used to look up the resources generated for a given role
+func ResourceName(name, role string) string {
+	return generateName(name, role)
+}
+
 func generateName(name, role string) string {
 	return fmt.Sprintf("%v-%v", name, role)
 }
 
+// InstanceLabels used to select every pod belonging to a redis instance
+// regardless of its role
+func InstanceLabels(name string) map[string]string {
+	return map[string]string{
+		NameLabel: name,
+	}
+}
+
+// MasterSelector used to select the pod acting as master
+func MasterSelector(name string) map[string]string {
+	return map[string]string{
+		NameLabel:   name,
+		MasterLabel: "true",
+	}
+}
+
+// SelectorLabels used to look up the pods of a given role
+func SelectorLabels(name, role string) map[string]string {
+	return getLabels(name, role)
+}
+
 func getLabels(name, role string) map[string]string {
 	return map[string]string{
-		"simple.simple.redis/name": name,
-		"simple.simple.redis/role": role,
+		NameLabel: name,
+		RoleLabel: role,
 	}
 }
 
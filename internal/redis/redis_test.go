@@ -0,0 +1,217 @@
+package redis
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("redis resources", func() {
+
+	Context("when generating resources for a port", func() {
+
+		It("should use the same port for the service, container and probes", func() {
+			svc := GenerateRedisSvc("redis-test", "default", "master", 7000)
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "6.2.3"), 1, 7000, nil)
+			container := deploy.Spec.Template.Spec.Containers[0]
+
+			Expect(svc.Spec.Ports).Should(HaveLen(1))
+			Expect(svc.Spec.Ports[0].Port).Should(Equal(int32(7000)))
+			Expect(svc.Spec.Ports[0].TargetPort).Should(Equal(intstr.FromString(container.Ports[0].Name)))
+			Expect(container.Ports[0].ContainerPort).Should(Equal(int32(7000)))
+			Expect(container.StartupProbe.Exec.Command[2]).Should(ContainSubstring("redis-cli -p 7000"))
+			Expect(container.LivenessProbe.Exec.Command[2]).Should(ContainSubstring("redis-cli -p 7000"))
+			Expect(container.ReadinessProbe.Exec.Command[2]).Should(ContainSubstring("redis-cli -p 7000"))
+		})
+
+		It("should expose the headless service on the same port", func() {
+			svc := GenerateHeadlessSvc("redis-test", "default", 7000)
+			Expect(svc.Spec.Ports[0].Port).Should(Equal(int32(7000)))
+			Expect(svc.Spec.Selector).Should(Equal(InstanceLabels("redis-test")))
+			for _, role := range []string{"master", "replica"} {
+				deploy := GenerateRedisDeploy("redis-test", "default", role, RedisEngine, "redis:7.0.11-alpine", 1, 7000, nil)
+				Expect(deploy.Spec.Template.Spec.Subdomain).Should(Equal(svc.Name))
+			}
+		})
+	})
+
+	Context("when generating resources for an engine", func() {
+
+		It("should use the images and binaries of the engine", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", KeyDBEngine, KeyDBEngine.Image("", "6.3.4"), 1, 6379, nil)
+			podSpec := deploy.Spec.Template.Spec
+			Expect(podSpec.Containers[0].Image).Should(Equal("eqalpha/keydb:v6.3.4"))
+			Expect(podSpec.Containers[0].LivenessProbe.Exec.Command[2]).Should(ContainSubstring("keydb-cli -p 6379"))
+			Expect(podSpec.Containers[0].ReadinessProbe.Exec.Command[2]).Should(ContainSubstring("keydb-cli -p 6379"))
+			Expect(ValkeyEngine.Image("", "8.0.1")).Should(Equal("valkey/valkey:8.0.1-alpine"))
+			Expect(RedisEngine.Image("registry.example.com/redis", "7.2.4")).Should(Equal("registry.example.com/redis:7.2.4-alpine"))
+		})
+
+		It("should fall back to redis for unknown engines", func() {
+			Expect(EngineFor("")).Should(Equal(RedisEngine))
+			Expect(EngineFor("valkey")).Should(Equal(ValkeyEngine))
+		})
+	})
+
+	Context("when restoring a dump", func() {
+
+		It("should download with the restore image and verify with the engine", func() {
+			for _, engine := range []Engine{RedisEngine, ValkeyEngine, KeyDBEngine} {
+				image := engine.Image("", "7.2.4")
+				deploy := GenerateRedisDeploy("redis-test", "default", "master", engine, image, 1, 6379, nil)
+				AddRestoreInitContainers(deploy, "redis-test", engine, Restore{URL: "https://backups.example.com/dump.rdb"})
+				initContainers := deploy.Spec.Template.Spec.InitContainers
+				Expect(initContainers).Should(HaveLen(2), engine.Name)
+
+				download := initContainers[0]
+				Expect(download.Name).Should(Equal(RestoreDownloadContainerName))
+				Expect(download.Image).Should(Equal(DefaultRestoreImage), engine.Name)
+				Expect(download.Command[2]).Should(ContainSubstring(`curl -fsSL -o /data/dump.rdb.tmp "$RESTORE_URL"`))
+				Expect(download.Command[2]).ShouldNot(ContainSubstring(engine.CheckRDB))
+
+				verify := initContainers[1]
+				Expect(verify.Name).Should(Equal(RestoreContainerName))
+				Expect(verify.Image).Should(Equal(image), engine.Name)
+				Expect(verify.Command[2]).Should(ContainSubstring("command -v " + engine.CheckRDB))
+				Expect(verify.Command[2]).Should(ContainSubstring(engine.CheckRDB + " /data/dump.rdb.tmp"))
+				Expect(verify.Command[2]).ShouldNot(ContainSubstring("curl"))
+				Expect(verify.Command[2]).ShouldNot(ContainSubstring("wget"))
+			}
+
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, "redis:7.2.4-alpine", 1, 6379, nil)
+			AddRestoreInitContainers(deploy, "redis-test", RedisEngine, Restore{URL: "https://backups.example.com/dump.rdb", Image: "mirror.example.com/curl:8.4.0"})
+			Expect(deploy.Spec.Template.Spec.InitContainers[0].Image).Should(Equal("mirror.example.com/curl:8.4.0"))
+		})
+
+		It("should skip the download once the instance was restored", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			AddRestoreInitContainers(deploy, "redis-test", RedisEngine, Restore{URL: "https://backups.example.com/dump.rdb"})
+			podSpec := deploy.Spec.Template.Spec
+			Expect(podSpec.InitContainers[0].Command[2]).Should(ContainSubstring("[ -f /restore-state/restored ]"))
+			Expect(podSpec.InitContainers[0].VolumeMounts).Should(ContainElement(HaveField("MountPath", "/restore-state")))
+			Expect(podSpec.Volumes).Should(ContainElement(HaveField("ConfigMap.Name", RestoreStateName("redis-test"))))
+			Expect(GenerateRestoreState("redis-test", "default", false).Data).Should(BeEmpty())
+			Expect(GenerateRestoreState("redis-test", "default", true).Data).Should(HaveKeyWithValue("restored", "true"))
+		})
+	})
+
+	Context("when adding the metrics exporter", func() {
+
+		It("should scrape the redis port with the shared password", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "6.2.3"), 1, 7000, nil)
+			AddAuthEnv(deploy, "redis-auth", "")
+			AddExporterSidecar(deploy, "", 7000)
+			Expect(deploy.Spec.Template.Spec.Containers).Should(HaveLen(2))
+			exporter := deploy.Spec.Template.Spec.Containers[1]
+			Expect(exporter.Image).Should(Equal(DefaultExporterImage))
+			Expect(exporter.Env[0].Value).Should(Equal("redis://localhost:7000"))
+			Expect(exporter.Env[1].Name).Should(Equal(PasswordEnv))
+		})
+
+		It("should authenticate as the admin user with a command policy", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "6.2.3"), 1, 7000, nil)
+			AddAuthEnv(deploy, "redis-auth", "")
+			AddAdminEnv(deploy, "redis-test")
+			AddExporterSidecar(deploy, "", 7000)
+			exporter := deploy.Spec.Template.Spec.Containers[1]
+			Expect(exporter.Env[1].Value).Should(Equal(AdminUser))
+			Expect(exporter.Env[2].Name).Should(Equal(PasswordEnv))
+			Expect(exporter.Env[2].ValueFrom.SecretKeyRef.Name).Should(Equal(AdminSecretName("redis-test")))
+		})
+	})
+
+	Context("when parsing INFO replication", func() {
+
+		It("should list the connected replicas in order", func() {
+			info := ParseInfo("# Replication\r\nrole:master\r\nconnected_slaves:2\r\n" +
+				"slave0:ip=10.0.0.2,port=6379,state=online,offset=42,lag=0\r\n" +
+				"slave1:ip=10.0.0.3,port=6379,state=wait_bgsave,offset=0,lag=3\r\n")
+			Expect(ParseReplicas(info)).Should(Equal([]Replica{
+				{IP: "10.0.0.2", Port: "6379", State: "online", Offset: 42, Lag: 0},
+				{IP: "10.0.0.3", Port: "6379", State: "wait_bgsave", Offset: 0, Lag: 3},
+			}))
+		})
+	})
+
+	Context("when loading modules", func() {
+
+		It("should copy modules shipped in an image before redis starts", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.2.4"), 1, 7000, nil)
+			modules := []Module{
+				{Name: "json", Path: "/usr/lib/redis/modules/rejson.so", Image: "redislabs/rejson:2.6.6"},
+				{Name: "search", Path: "/opt/redis-stack/lib/redisearch.so", Args: []string{"MAXSEARCHRESULTS", "1000"}},
+			}
+			AddModules(deploy, modules)
+			podSpec := deploy.Spec.Template.Spec
+			Expect(ModuleArgs(modules)).Should(Equal([]string{
+				"--loadmodule /modules/json.so",
+				"--loadmodule /opt/redis-stack/lib/redisearch.so MAXSEARCHRESULTS 1000",
+			}))
+			Expect(podSpec.InitContainers).Should(HaveLen(1))
+			Expect(podSpec.InitContainers[0].Name).Should(Equal("module-json"))
+			Expect(podSpec.InitContainers[0].Command).Should(Equal([]string{"cp", "/usr/lib/redis/modules/rejson.so", "/modules/json.so"}))
+			Expect(podSpec.Containers[0].VolumeMounts).Should(ContainElement(podSpec.InitContainers[0].VolumeMounts[0]))
+		})
+
+		It("should leave the pod alone without modules in an image", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.2.4"), 1, 7000, nil)
+			AddModules(deploy, []Module{{Name: "json", Path: "/opt/redis-stack/lib/rejson.so"}})
+			Expect(deploy.Spec.Template.Spec.InitContainers).Should(BeEmpty())
+			Expect(deploy.Spec.Template.Spec.Volumes).Should(HaveLen(2))
+		})
+
+		It("should read the loaded modules from MODULE LIST", func() {
+			loaded, err := ParseModuleList([]interface{}{
+				[]interface{}{"name", "search", "ver", int64(20809), "path", "/modules/search.so", "args", []interface{}{}},
+				[]interface{}{"name", "ReJSON", "ver", int64(20606), "path", "/modules/json.so", "args", []interface{}{}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).Should(Equal([]LoadedModule{
+				{Name: "ReJSON", Version: "2.6.6"},
+				{Name: "search", Version: "2.8.9"},
+			}))
+		})
+	})
+
+	Context("when rendering a command policy", func() {
+
+		It("should remove the admin and disabled commands from the default user only", func() {
+			args := ACLArgs([]string{"FLUSHALL", "keys"}, true, true)
+			Expect(args).Should(Equal([]string{
+				"--user default on >$(REDIS_PASSWORD) ~* &* +@all -@admin -flushall -keys",
+				"--user operator on >$(REDIS_ADMIN_PASSWORD) ~* &* +@all",
+				"--masteruser operator",
+				"--masterauth $(REDIS_ADMIN_PASSWORD)",
+			}))
+		})
+
+		It("should leave the default user without a password when auth is disabled", func() {
+			args := ACLArgs(nil, false, false)
+			Expect(args[0]).Should(Equal("--user default on nopass ~* +@all -@admin"))
+		})
+
+		It("should render renamed commands in a stable order", func() {
+			args := RenameArgs(map[string]string{"KEYS": "scan-keys", "flushall": "nuke"})
+			Expect(args).Should(Equal([]string{
+				"--rename-command flushall nuke",
+				"--rename-command keys scan-keys",
+			}))
+		})
+	})
+
+	Context("when generating network policies", func() {
+
+		It("should refuse every source without peers", func() {
+			policy := GenerateNetworkPolicy("redis-test", "default", "clients", 7000, nil)
+			Expect(policy.Spec.PodSelector.MatchLabels).Should(Equal(InstanceLabels("redis-test")))
+			Expect(policy.Spec.Ingress).Should(BeEmpty())
+		})
+
+		It("should only open the given port to the peers", func() {
+			policy := GenerateNetworkPolicy("redis-test", "default", "replication", 7000, ReplicationPeers("redis-test"))
+			Expect(policy.Spec.Ingress).Should(HaveLen(1))
+			Expect(policy.Spec.Ingress[0].Ports[0].Port.IntValue()).Should(Equal(7000))
+			Expect(policy.Spec.Ingress[0].From).Should(HaveLen(2))
+		})
+	})
+})
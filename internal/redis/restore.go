@@ -0,0 +1,155 @@
+package redis
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RestoreContainerName is the name of the init container verifying and
+	// moving the dump into place, used to look up restore progress on the
+	// pod status
+	RestoreContainerName = "restore"
+	// RestoreDownloadContainerName is the name of the init container
+	// downloading the dump
+	RestoreDownloadContainerName = "restore-download"
+	// DefaultRestoreImage is the image downloading the dump when none is
+	// given, the engine images do not all ship a download tool
+	DefaultRestoreImage = "curlimages/curl:8.4.0"
+	// restoreStateVolume mounts the restore state config map into the init
+	// containers
+	restoreStateVolume = "restore-state"
+	restoreStateDir    = "/restore-state"
+	// restoredKey is set on the restore state config map once the instance
+	// was restored
+	restoredKey = "restored"
+)
+
+// Restore describes where the dump seeding an instance is downloaded from
+type Restore struct {
+	URL        string
+	SHA256     string
+	SecretName string
+	// Image of the download container, DefaultRestoreImage when empty
+	Image string
+}
+
+// downloadScript downloads the dump next to the data directory and verifies
+// the checksum. An existing dump.rdb means the restore already happened for
+// this pod, the restored key of the state config map that it happened for
+// the instance and the pod syncs from the acting master instead
+const downloadScript = `set -e
+if [ -f /restore-state/restored ]; then
+  echo "instance already restored, syncing from the acting master instead"
+  exit 0
+fi
+if [ -f /data/dump.rdb ]; then
+  echo "dump.rdb already present, skipping restore"
+  exit 0
+fi
+curl -fsSL -o /data/dump.rdb.tmp "$RESTORE_URL"
+if [ -n "$RESTORE_SHA256" ]; then
+  echo "$RESTORE_SHA256  /data/dump.rdb.tmp" | sha256sum -c -
+fi
+`
+
+// restoreScript verifies the rdb structure of a downloaded dump with the check
+// tool of the engine and only then moves it into place
+const restoreScript = `set -e
+if [ ! -f /data/dump.rdb.tmp ]; then
+  echo "no dump downloaded, skipping restore"
+  exit 0
+fi
+if ! command -v %[1]v >/dev/null 2>&1; then
+  echo "%[1]v not found in the image, cannot verify the dump"
+  exit 1
+fi
+%[1]v /data/dump.rdb.tmp
+mv /data/dump.rdb.tmp /data/dump.rdb
+`
+
+// RestoreStateName used to name the config map recording that an instance
+// was restored
+func RestoreStateName(name string) string {
+	return generateName(name, "restore")
+}
+
+// GenerateRestoreState used to setup the config map the restore init
+// container checks before downloading. It is updated once the instance was
+// restored, unlike the pod template, so master pods created later skip the
+// download without the master deployment rolling out
+func GenerateRestoreState(name, ns string, restored bool) *v1.ConfigMap {
+	data := map[string]string{}
+	if restored {
+		data[restoredKey] = "true"
+	}
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RestoreStateName(name),
+			Namespace: ns,
+			Labels:    getLabels(name, "restore"),
+		},
+		Data: data,
+	}
+}
+
+// AddRestoreInitContainers used to add the init containers to the deployment
+// of the named instance that download and verify a dump.rdb before redis
+// starts. The download runs in its own image, the verification in the image
+// of the engine which ships the check tool
+func AddRestoreInitContainers(deploy *appsv1.Deployment, name string, engine Engine, restore Restore) {
+	image := restore.Image
+	if image == "" {
+		image = DefaultRestoreImage
+	}
+	podSpec := &deploy.Spec.Template.Spec
+	mounts := []v1.VolumeMount{
+		{
+			Name:      dataVolume,
+			MountPath: dataDir,
+		},
+		{
+			Name:      restoreStateVolume,
+			MountPath: restoreStateDir,
+			ReadOnly:  true,
+		},
+	}
+	download := v1.Container{
+		Name:    RestoreDownloadContainerName,
+		Image:   image,
+		Command: []string{"sh", "-c", downloadScript},
+		Env: []v1.EnvVar{
+			{Name: "RESTORE_URL", Value: restore.URL},
+			{Name: "RESTORE_SHA256", Value: restore.SHA256},
+		},
+		VolumeMounts: mounts,
+	}
+	if restore.SecretName != "" {
+		download.EnvFrom = []v1.EnvFromSource{
+			{
+				SecretRef: &v1.SecretEnvSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: restore.SecretName},
+				},
+			},
+		}
+	}
+	verify := v1.Container{
+		Name:         RestoreContainerName,
+		Image:        podSpec.Containers[0].Image,
+		Command:      []string{"sh", "-c", fmt.Sprintf(restoreScript, engine.CheckRDB)},
+		VolumeMounts: mounts,
+	}
+	podSpec.InitContainers = append(podSpec.InitContainers, download, verify)
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: restoreStateVolume,
+		VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: RestoreStateName(name)},
+				Optional:             boolPtr(true),
+			},
+		},
+	})
+}
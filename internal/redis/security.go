@@ -0,0 +1,65 @@
+package redis
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// RedisUser is the uid and gid of the redis user in the official images
+	RedisUser = 999
+	// tmpVolume is an emptyDir mounted at /tmp as the root filesystem is
+	// read only
+	tmpVolume = "tmp"
+	tmpDir    = "/tmp"
+)
+
+// DefaultPodSecurityContext used to get the hardened pod security context
+// applied when the spec sets none, it satisfies the restricted pod security
+// standard
+func DefaultPodSecurityContext() *v1.PodSecurityContext {
+	user := int64(RedisUser)
+	return &v1.PodSecurityContext{
+		RunAsNonRoot: boolPtr(true),
+		RunAsUser:    &user,
+		RunAsGroup:   &user,
+		FSGroup:      &user,
+		SeccompProfile: &v1.SeccompProfile{
+			Type: v1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// DefaultContainerSecurityContext used to get the hardened container security
+// context applied when the spec sets none
+func DefaultContainerSecurityContext() *v1.SecurityContext {
+	return &v1.SecurityContext{
+		RunAsNonRoot:             boolPtr(true),
+		AllowPrivilegeEscalation: boolPtr(false),
+		ReadOnlyRootFilesystem:   boolPtr(true),
+		Capabilities: &v1.Capabilities{
+			Drop: []v1.Capability{"ALL"},
+		},
+		SeccompProfile: &v1.SeccompProfile{
+			Type: v1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// SetSecurityContext used to set the pod security context and the security
+// context of every container, including init containers and sidecars, so it
+// needs to run after they were added
+func SetSecurityContext(deploy *appsv1.Deployment, pod *v1.PodSecurityContext, container *v1.SecurityContext) {
+	podSpec := &deploy.Spec.Template.Spec
+	podSpec.SecurityContext = pod.DeepCopy()
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].SecurityContext = container.DeepCopy()
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].SecurityContext = container.DeepCopy()
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/pod-security-admission/api"
+	"k8s.io/pod-security-admission/policy"
+)
+
+var _ = Describe("redis security context", func() {
+
+	Context("when using the hardened defaults", func() {
+
+		It("should satisfy the restricted pod security standard", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			AddAuthEnv(deploy, "redis-auth", "")
+			AddRestoreInitContainers(deploy, "redis-test", RedisEngine, Restore{URL: "https://backups.example.com/dump.rdb"})
+			AddExporterSidecar(deploy, "", 6379)
+			SetSecurityContext(deploy, DefaultPodSecurityContext(), DefaultContainerSecurityContext())
+
+			evaluator, err := policy.NewEvaluator(policy.DefaultChecks())
+			Expect(err).ShouldNot(HaveOccurred())
+			template := deploy.Spec.Template
+			results := evaluator.EvaluatePod(
+				api.LevelVersion{Level: api.LevelRestricted, Version: api.LatestVersion()},
+				&template.ObjectMeta,
+				&template.Spec,
+			)
+			for _, result := range results {
+				Expect(result.Allowed).Should(BeTrue(), "%v: %v", result.ForbiddenReason, result.ForbiddenDetail)
+			}
+		})
+
+		It("should mount a writable /tmp next to the read only root filesystem", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			container := deploy.Spec.Template.Spec.Containers[0]
+			Expect(*container.SecurityContext.ReadOnlyRootFilesystem).Should(BeTrue())
+			Expect(container.VolumeMounts).Should(ContainElement(HaveField("MountPath", "/tmp")))
+		})
+	})
+
+	Context("when the spec sets the security context", func() {
+
+		It("should apply it to every container", func() {
+			deploy := GenerateRedisDeploy("redis-test", "default", "master", RedisEngine, RedisEngine.Image("", "7.0.11"), 1, 6379, nil)
+			AddRestoreInitContainers(deploy, "redis-test", RedisEngine, Restore{URL: "https://backups.example.com/dump.rdb"})
+			container := DefaultContainerSecurityContext()
+			container.ReadOnlyRootFilesystem = boolPtr(false)
+			SetSecurityContext(deploy, DefaultPodSecurityContext(), container)
+			Expect(*deploy.Spec.Template.Spec.InitContainers[0].SecurityContext.ReadOnlyRootFilesystem).Should(BeFalse())
+			Expect(*deploy.Spec.Template.Spec.Containers[0].SecurityContext.ReadOnlyRootFilesystem).Should(BeFalse())
+		})
+	})
+})
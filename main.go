@@ -17,22 +17,35 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	simplev2 "github.com/spazzy757/simple-redis/api/v2"
 	"github.com/spazzy757/simple-redis/controllers"
+	"github.com/spazzy757/simple-redis/internal/config"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -45,6 +58,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(simplev1.AddToScheme(scheme))
+	utilruntime.Must(simplev2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,11 +66,29 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var watchNamespaces string
+	var namespaceSelector string
+	var excludeNamespaces string
+	var configFile string
+	var resyncPeriod time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated list of namespaces to watch. Every namespace is watched when neither "+
+			"this nor --namespace-selector is set.")
+	flag.StringVar(&namespaceSelector, "namespace-selector", "",
+		"Label selector of additional namespaces to watch. The selector is resolved once at startup, "+
+			"namespaces labelled later are picked up on restart. Listing namespaces needs a ClusterRole.")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "",
+		"Comma separated list of namespaces not to reconcile, such as the ones running their own operator "+
+			"with the namespaced overlay. The webhooks are still served for them.")
+	flag.StringVar(&configFile, "config", "",
+		"Path of the operator config file holding fleet wide defaults. The file is reloaded when it changes.")
+	flag.DurationVar(&resyncPeriod, "resync-period", controllers.DefaultResyncPeriod,
+		"How often settled redis instances are reconciled again to pick up changes of the running instances.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,7 +97,21 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	operatorConfig, err := config.NewStore(configFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load the operator config")
+		os.Exit(1)
+	}
+
+	cfg := ctrl.GetConfigOrDie()
+	excluded := splitNamespaces(excludeNamespaces)
+	namespaces, err := resolveNamespaces(cfg, watchNamespaces, namespaceSelector, excluded)
+	if err != nil {
+		setupLog.Error(err, "unable to resolve the namespaces to watch")
+		os.Exit(1)
+	}
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
@@ -83,25 +129,64 @@ func main() {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		// LeaderElectionReleaseOnCancel: true,
-	})
+	}
+	// restricting the cache to the watched namespaces lets the operator run
+	// with a namespaced Role instead of a ClusterRole
+	switch len(namespaces) {
+	case 0:
+		setupLog.Info("watching every namespace")
+	case 1:
+		setupLog.Info("watching a single namespace", "namespace", namespaces[0])
+		options.Namespace = namespaces[0]
+	default:
+		setupLog.Info("watching multiple namespaces", "namespaces", namespaces)
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(cfg, options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.RedisReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("redis-controller"),
+		Defaults: operatorConfig.Defaults,
+		// settled instances are reconciled again to pick up changes of the
+		// running redis instances
+		ResyncPeriod: resyncPeriod,
+		// left to the namespaced operators, which rely on this operator for
+		// the webhooks only
+		ExcludeNamespaces: excluded,
+		// set through the downward API, the network policies allow the
+		// operator pods of this namespace
+		OperatorNamespace: os.Getenv("POD_NAMESPACE"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Redis")
 		os.Exit(1)
 	}
-	if err = (&simplev1.Redis{}).SetupWebhookWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create webhook", "webhook", "Redis")
-		os.Exit(1)
+	// the webhooks are served by a single cluster wide operator, namespaced
+	// operators run with ENABLE_WEBHOOKS=false
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		simplev1.SetOperatorDefaults(operatorConfig.Defaults)
+		if err = (&simplev1.Redis{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Redis")
+			os.Exit(1)
+		}
+		if err = (&simplev2.Redis{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Redis")
+			os.Exit(1)
+		}
 	}
 	//+kubebuilder:scaffold:builder
 
+	if err := mgr.Add(operatorConfig); err != nil {
+		setupLog.Error(err, "unable to reload the operator config")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -117,3 +202,64 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitNamespaces used to split a comma separated list of namespaces
+func splitNamespaces(names string) []string {
+	var namespaces []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			namespaces = append(namespaces, name)
+		}
+	}
+	return namespaces
+}
+
+// resolveNamespaces used to merge the namespaces given by name with the ones
+// matching the namespace selector without the excluded ones, empty when every
+// namespace is watched. Listing namespaces is granted by the
+// namespace-reader-role ClusterRole in config/rbac, namespaced operators are
+// refused the selector unless a cluster admin binds it
+func resolveNamespaces(cfg *rest.Config, names, selector string, excluded []string) ([]string, error) {
+	set := map[string]struct{}{}
+	for _, name := range splitNamespaces(names) {
+		set[name] = struct{}{}
+	}
+	if selector != "" {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+		c, err := client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, err
+		}
+		var list corev1.NamespaceList
+		if err := c.List(context.Background(), &list, client.MatchingLabelsSelector{Selector: sel}); err != nil {
+			if apierrors.IsForbidden(err) {
+				return nil, fmt.Errorf("--namespace-selector needs a ClusterRole allowing to list namespaces: %w", err)
+			}
+			return nil, err
+		}
+		if len(list.Items) == 0 && len(set) == 0 {
+			// an empty list would fall back to watching every namespace
+			return nil, fmt.Errorf("no namespace matches the namespace selector %q", selector)
+		}
+		for _, ns := range list.Items {
+			set[ns.Name] = struct{}{}
+		}
+	}
+	watched := len(set) > 0
+	for _, name := range excluded {
+		delete(set, name)
+	}
+	if watched && len(set) == 0 {
+		// an empty list would fall back to watching every namespace
+		return nil, fmt.Errorf("every watched namespace is excluded")
+	}
+	namespaces := make([]string, 0, len(set))
+	for name := range set {
+		namespaces = append(namespaces, name)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
@@ -0,0 +1,61 @@
+//go:build e2e
+// +build e2e
+
+package e2e
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	simplev1 "github.com/spazzy757/simple-redis/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("redis replication", func() {
+
+	const (
+		redisName      = "redis-e2e"
+		redisNamespace = "default"
+
+		timeout  = time.Minute * 5
+		interval = time.Second * 5
+	)
+
+	It("should connect every replica to the master", func() {
+		ctx := context.Background()
+		for _, port := range []int{0, 7000} {
+			By("creating a redis resource")
+			redis := &simplev1.Redis{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redisName,
+					Namespace: redisNamespace,
+				},
+				Spec: simplev1.RedisSpec{
+					ClusterSize: 3,
+					Port:        port,
+				},
+			}
+			Expect(k8sClient.Create(ctx, redis)).Should(Succeed())
+
+			// status.replicas only counts replicas reporting an up master
+			// link, so reaching the cluster size means replication connected
+			By("waiting for every replica to sync from the master")
+			lookup := types.NamespacedName{Name: redisName, Namespace: redisNamespace}
+			Eventually(func() int32 {
+				created := &simplev1.Redis{}
+				if err := k8sClient.Get(ctx, lookup, created); err != nil {
+					return 0
+				}
+				return created.Status.Replicas
+			}, timeout, interval).Should(Equal(int32(3)))
+
+			Expect(k8sClient.Delete(ctx, redis)).Should(Succeed())
+			Eventually(func() bool {
+				return k8sClient.Get(ctx, lookup, &simplev1.Redis{}) != nil
+			}, timeout, interval).Should(BeTrue())
+		}
+	})
+})